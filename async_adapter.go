@@ -15,6 +15,7 @@
 package yarn
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync/atomic"
@@ -81,12 +82,17 @@ type AsyncAdapter struct {
 	state   atomic.Int32
 	handler AsyncDialogueHandler
 	msgCh   chan asyncMsg
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
 }
 
 // NewAsyncAdapter returns a new AsyncAdapter.
 func NewAsyncAdapter(h AsyncDialogueHandler) *AsyncAdapter {
+	ctx, cancel := context.WithCancelCause(context.Background())
 	return &AsyncAdapter{
 		handler: h,
+		ctx:     ctx,
+		cancel:  cancel,
 		// The user might call Go from within their handler's Line method
 		// (or however many other ways to try to continue the VM immediately).
 		// If msgCh was unbuffered, calling Go would wait forever trying to send
@@ -149,10 +155,19 @@ func (a *AsyncAdapter) Abort(err error) error {
 	if err == nil {
 		err = Stop
 	}
+	a.cancel(err)
 	a.msgCh <- abortMsg{err}
 	return nil
 }
 
+// Context returns a context that is cancelled when Abort is called. The cause
+// of the cancellation (see context.Cause) is the error passed to Abort (or
+// Stop). When the AsyncAdapter is used as the VM's Handler, the VM uses this
+// context to cancel commands in progress, such as wait.
+func (a *AsyncAdapter) Context() context.Context {
+	return a.ctx
+}
+
 // waitForGo waits for Go or Abort to be called.
 func (a *AsyncAdapter) waitForGo() error {
 	switch msg := (<-a.msgCh).(type) {
@@ -0,0 +1,366 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+)
+
+// AttributedString is a string with additional attributes, such as presentation
+// or styling information, that apply to the whole string or substrings.
+type AttributedString struct {
+	str  string
+	atts []*Attribute // in the order the tags were opened
+
+	positions map[int]textPosition // byte offset -> position, for attribute boundaries
+}
+
+// newAttributedString returns an AttributedString, with the positions of
+// attribute boundaries computed.
+func newAttributedString(str string, atts []*Attribute) *AttributedString {
+	s := &AttributedString{str: str, atts: atts}
+	s.index()
+	return s
+}
+
+func (s *AttributedString) String() string { return s.str }
+
+// Attributes returns all the attributes, in the order their tags were opened
+// (the implicit character attribute is first).
+func (s *AttributedString) Attributes() []*Attribute {
+	return slices.Clone(s.atts)
+}
+
+// AttributesNamed returns the attributes with the name, in the order their
+// tags were opened.
+func (s *AttributedString) AttributesNamed(name string) []*Attribute {
+	var as []*Attribute
+	for _, a := range s.atts {
+		if a.Name == name {
+			as = append(as, a)
+		}
+	}
+	return as
+}
+
+// AttributeAt returns the attributes that apply to the byte at pos (that is,
+// Start <= pos < End), in the order their tags were opened. Attributes that
+// mark up nothing (such as self-closing tags) never apply.
+func (s *AttributedString) AttributeAt(pos int) []*Attribute {
+	var as []*Attribute
+	for _, a := range s.atts {
+		if a.Start <= pos && pos < a.End {
+			as = append(as, a)
+		}
+	}
+	return as
+}
+
+// characterAttribute returns the character attribute (either implicit, or
+// from a [character] tag at the start of the line), or nil.
+func (s *AttributedString) characterAttribute() *Attribute {
+	for _, a := range s.atts {
+		if a.Name == "character" && a.Start == 0 {
+			return a
+		}
+	}
+	return nil
+}
+
+// CharacterName returns the name of the character speaking the line (from
+// the "name" property of the character attribute), and whether there is one.
+func (s *AttributedString) CharacterName() (string, bool) {
+	a := s.characterAttribute()
+	if a == nil {
+		return "", false
+	}
+	name, ok := a.Props["name"]
+	return name.String(), ok
+}
+
+// TextWithoutCharacterName returns the string with the text covered by the
+// character attribute removed. For example, for "Mae: Hello!", it returns
+// "Hello!". If there is no character attribute, it returns the whole string.
+func (s *AttributedString) TextWithoutCharacterName() string {
+	a := s.characterAttribute()
+	if a == nil {
+		return s.str
+	}
+	return s.str[a.End:]
+}
+
+// Span is a run of text within an AttributedString, and the attributes that
+// apply to all of it.
+type Span struct {
+	Start, End int
+	Text       string
+	Attributes []*Attribute // in the order their tags were opened
+}
+
+// Spans splits the string into consecutive runs of text with the same
+// attributes. Together the spans cover the whole string, and each span is
+// non-empty. Attributes that mark up nothing (such as self-closing tags) are
+// not in any span (see ScanAttribEvents).
+func (s *AttributedString) Spans() []Span {
+	if s.str == "" {
+		return nil
+	}
+	bounds := []int{0, len(s.str)}
+	for _, a := range s.atts {
+		bounds = append(bounds, a.Start, a.End)
+	}
+	sort.Ints(bounds)
+	bounds = slices.Compact(bounds)
+	spans := make([]Span, 0, len(bounds)-1)
+	for i := 1; i < len(bounds); i++ {
+		start, end := bounds[i-1], bounds[i]
+		if start < 0 || end > len(s.str) {
+			continue
+		}
+		sp := Span{Start: start, End: end, Text: s.str[start:end]}
+		for _, a := range s.atts {
+			if a.Start <= start && end <= a.End {
+				sp.Attributes = append(sp.Attributes, a)
+			}
+		}
+		spans = append(spans, sp)
+	}
+	return spans
+}
+
+// Substring returns the part of the string from byte start to byte end, with
+// the attributes that overlap it. The attributes are copies, clipped to the
+// substring, with positions relative to start. Attributes that mark up
+// nothing are included if they are within [start, end]. Like slicing a
+// string, Substring panics if the range is out of bounds.
+func (s *AttributedString) Substring(start, end int) *AttributedString {
+	var atts []*Attribute
+	for _, a := range s.atts {
+		switch {
+		case a.Start == a.End && (a.Start < start || a.Start > end):
+			continue
+		case a.Start < a.End && (a.End <= start || a.Start >= end):
+			continue
+		}
+		c := *a
+		c.Start = min(max(a.Start, start), end) - start
+		c.End = min(max(a.End, start), end) - start
+		c.Props = maps.Clone(a.Props)
+		atts = append(atts, &c)
+	}
+	return newAttributedString(s.str[start:end], atts)
+}
+
+// ScanAttribEvents calls visit with each change in attribute state. pos is the
+// byte position in the string where the change occurs. atts will contain the
+// attributes that either end or start at pos: first those ending at pos (in
+// reverse order of opening, as they would be closed), then those starting at
+// pos (in order of opening). Self-closing tags, or an open and close pair that
+// apply to the same position (i.e. marking up nothing) will only be present in
+// atts once (as a start).
+// For example, for the original string:
+//
+//	`[a]Hello A[/a] [b]Hello B[/b] [c][d][/c]No C, [e/]only D[/d]`
+//
+// which is processed into the unattributed string:
+//
+//	`Hello A Hello B No C, only D`
+//
+// ScanAttribEvents will visit:
+// * (0, [a])    -- open of a
+// * (7, [a])    -- close of a
+// * (8, [b])    -- open of b
+// * (15, [b])   -- close of b
+// * (16, [c,d]) -- close of c applies to same position, so it appears once
+// * (22, [e])   -- e is self-closing, so it appears once
+// * (28, [d])   -- close of d
+func (s *AttributedString) ScanAttribEvents(visit func(pos int, atts []*Attribute)) {
+	events := make(map[int][]*Attribute)
+	for i := len(s.atts) - 1; i >= 0; i-- {
+		if a := s.atts[i]; a.Start < a.End {
+			events[a.End] = append(events[a.End], a)
+		}
+	}
+	for _, a := range s.atts {
+		events[a.Start] = append(events[a.Start], a)
+	}
+	positions := make([]int, 0, len(events))
+	for pos := range events {
+		positions = append(positions, pos)
+	}
+	sort.Ints(positions)
+	for _, pos := range positions {
+		visit(pos, events[pos])
+	}
+}
+
+// attributedStringJSON is the JSON encoding of an AttributedString.
+type attributedStringJSON struct {
+	Text       string       `json:"text"`
+	Attributes []*Attribute `json:"attributes,omitempty"`
+}
+
+// MarshalJSON encodes the string and its attributes as a JSON object, for
+// example:
+//
+//	{"text":"Mae: Hi!","attributes":[{"start":0,"end":5,"name":"character","props":{"name":"Mae"}}]}
+//
+// Attributes are in the order their tags were opened.
+func (s *AttributedString) MarshalJSON() ([]byte, error) {
+	return json.Marshal(attributedStringJSON{Text: s.str, Attributes: s.atts})
+}
+
+// UnmarshalJSON decodes a string and its attributes encoded by MarshalJSON.
+func (s *AttributedString) UnmarshalJSON(b []byte) error {
+	var j attributedStringJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	for _, a := range j.Attributes {
+		if a == nil || a.Start < 0 || a.End < a.Start || a.End > len(j.Text) {
+			return fmt.Errorf("attribute %+v out of range for text of length %d", a, len(j.Text))
+		}
+	}
+	*s = *newAttributedString(j.Text, j.Attributes)
+	return nil
+}
+
+// Position is a position within an AttributedString, measured in various
+// units: bytes of UTF-8 (as used by Attribute), runes (Unicode code points),
+// UTF-16 code units (as used by some engines and by JavaScript), and
+// extended grapheme clusters (user-perceived characters, such as an emoji
+// with a skin tone modifier, or a letter with combining accents). Positions
+// are in logical order, even in right-to-left text.
+type Position struct {
+	Byte, Rune, UTF16, Grapheme int
+}
+
+// textPosition is a Position, and whether it is within a grapheme cluster
+// (rather than at the start of one).
+type textPosition struct {
+	Position
+	mid bool
+}
+
+// Position converts a byte offset into a Position. If offset is within a
+// grapheme cluster, Grapheme is the index of that cluster. Positions of
+// attribute boundaries are computed when the string is rendered; other
+// positions are computed by scanning the string.
+func (s *AttributedString) Position(offset int) Position {
+	return s.position(offset).Position
+}
+
+// AttributeRange returns the range of the attribute as Positions. If the
+// attribute starts or ends within a grapheme cluster, the grapheme range is
+// widened to include the whole cluster.
+func (s *AttributedString) AttributeRange(a *Attribute) (start, end Position) {
+	start = s.position(a.Start).Position
+	e := s.position(a.End)
+	if e.mid {
+		e.Grapheme++
+	}
+	return start, e.Position
+}
+
+// Len returns the length of the string in each unit.
+func (s *AttributedString) Len() Position {
+	return s.position(len(s.str)).Position
+}
+
+func (s *AttributedString) position(offset int) textPosition {
+	offset = min(max(offset, 0), len(s.str))
+	if p, ok := s.positions[offset]; ok {
+		return p
+	}
+	var pos textPosition
+	s.walk(func(p textPosition) bool {
+		pos = p
+		return p.Byte < offset
+	})
+	return pos
+}
+
+// index computes the positions of the ends of the string and of attribute
+// boundaries.
+func (s *AttributedString) index() {
+	want := map[int]bool{0: true, len(s.str): true}
+	for _, a := range s.atts {
+		want[a.Start] = true
+		want[a.End] = true
+	}
+	s.positions = make(map[int]textPosition, len(want))
+	s.walk(func(p textPosition) bool {
+		if want[p.Byte] {
+			s.positions[p.Byte] = p
+		}
+		return len(s.positions) < len(want)
+	})
+}
+
+// walk calls visit with the position of each rune in the string, and the end
+// of the string, until visit returns false.
+func (s *AttributedString) walk(visit func(textPosition) bool) {
+	var (
+		p          textPosition
+		clusterEnd int // end of the current grapheme cluster
+		started    int // number of grapheme clusters starting before p.Byte
+		state      = -1
+	)
+	for {
+		p.mid = p.Byte < clusterEnd
+		p.Grapheme = started
+		if p.mid {
+			p.Grapheme--
+		} else if p.Byte < len(s.str) {
+			var cluster string
+			cluster, _, _, state = uniseg.FirstGraphemeClusterInString(s.str[p.Byte:], state)
+			clusterEnd = p.Byte + len(cluster)
+		}
+		if !visit(p) || p.Byte >= len(s.str) {
+			return
+		}
+		if !p.mid {
+			started++
+		}
+		r, n := utf8.DecodeRuneInString(s.str[p.Byte:])
+		p.Byte += n
+		p.Rune++
+		p.UTF16 += max(utf16.RuneLen(r), 1)
+	}
+}
+
+// Attribute describes a range within a string with additional information
+// provided by markup tags. Start and End specify the range in bytes. Name is
+// the tag name, and Props contains any additional key=value tag properties.
+//
+// Property values are typed in the same way as Yarn Spinner: quoted strings
+// are strings, true and false are bools, numbers such as 1 or -2.5 are
+// numbers, and any other unquoted word is a string. Substituted values ({0})
+// are typed according to the substituted text. A tag of the form [wave=2] has
+// a property with the same name as the tag (i.e. Props["wave"] is 2).
+type Attribute struct {
+	Start int              `json:"start"`
+	End   int              `json:"end"`
+	Name  string           `json:"name"`
+	Props map[string]Value `json:"props,omitempty"`
+}
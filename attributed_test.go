@@ -0,0 +1,267 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/text/language"
+)
+
+func mustRender(t *testing.T, input string) *AttributedString {
+	t.Helper()
+	row := &StringTableRow{Text: input}
+	as, err := row.Render(nil, language.English)
+	if err != nil {
+		t.Fatalf("Render(%q) = %v", input, err)
+	}
+	return as
+}
+
+func TestSpans(t *testing.T) {
+	as := mustRender(t, "Mae: [b]Hello [i]there[/i][/b][e/] friend")
+	chr := &Attribute{Start: 0, End: 5, Name: "character", Props: map[string]Value{"name": StringValue("Mae")}}
+	b := &Attribute{Start: 5, End: 16, Name: "b"}
+	i := &Attribute{Start: 11, End: 16, Name: "i"}
+	want := []Span{
+		{Start: 0, End: 5, Text: "Mae: ", Attributes: []*Attribute{chr}},
+		{Start: 5, End: 11, Text: "Hello ", Attributes: []*Attribute{b}},
+		{Start: 11, End: 16, Text: "there", Attributes: []*Attribute{b, i}},
+		{Start: 16, End: 23, Text: " friend"},
+	}
+	if diff := cmp.Diff(as.Spans(), want); diff != "" {
+		t.Errorf("Spans() diff (-got +want):\n%s", diff)
+	}
+	if got := mustRender(t, "").Spans(); got != nil {
+		t.Errorf("Spans() of empty string = %v, want nil", got)
+	}
+}
+
+func TestAttributeLookup(t *testing.T) {
+	as := mustRender(t, "[a]x[b]y[/b][a]z[/a][/a]")
+	a1 := &Attribute{Start: 0, End: 3, Name: "a"}
+	b := &Attribute{Start: 1, End: 2, Name: "b"}
+	a2 := &Attribute{Start: 2, End: 3, Name: "a"}
+
+	if diff := cmp.Diff(as.Attributes(), []*Attribute{a1, b, a2}); diff != "" {
+		t.Errorf("Attributes() diff (-got +want):\n%s", diff)
+	}
+	if diff := cmp.Diff(as.AttributesNamed("a"), []*Attribute{a1, a2}); diff != "" {
+		t.Errorf("AttributesNamed(a) diff (-got +want):\n%s", diff)
+	}
+	tests := []struct {
+		pos  int
+		want []*Attribute
+	}{
+		{0, []*Attribute{a1}},
+		{1, []*Attribute{a1, b}},
+		{2, []*Attribute{a1, a2}},
+		{3, nil},
+	}
+	for _, test := range tests {
+		if diff := cmp.Diff(as.AttributeAt(test.pos), test.want); diff != "" {
+			t.Errorf("AttributeAt(%d) diff (-got +want):\n%s", test.pos, diff)
+		}
+	}
+}
+
+func TestSubstring(t *testing.T) {
+	as := mustRender(t, "Hello [b]brave [i]new[/i] world[/b][e/]!")
+	sub := as.Substring(8, 21)
+	if got, want := sub.String(), "ave new world"; got != want {
+		t.Errorf("Substring(8, 21).String() = %q, want %q", got, want)
+	}
+	want := []*Attribute{
+		{Start: 0, End: 13, Name: "b"},
+		{Start: 4, End: 7, Name: "i"},
+		{Start: 13, End: 13, Name: "e"},
+	}
+	if diff := cmp.Diff(sub.Attributes(), want); diff != "" {
+		t.Errorf("Substring(8, 21).Attributes() diff (-got +want):\n%s", diff)
+	}
+	// The original is unchanged.
+	if got := as.AttributesNamed("b")[0]; got.Start != 6 || got.End != 21 {
+		t.Errorf("original b attribute = %+v, want Start: 6, End: 21", got)
+	}
+}
+
+func TestCloseAllOrdering(t *testing.T) {
+	// The order of events at the close-all tag should not depend on map
+	// iteration order.
+	const input = "[a][b][c][d]x[/]y"
+	type event struct {
+		Pos   int
+		Names []string
+	}
+	want := []event{
+		{0, []string{"a", "b", "c", "d"}},
+		{1, []string{"d", "c", "b", "a"}},
+	}
+	for range 20 {
+		var got []event
+		mustRender(t, input).ScanAttribEvents(func(pos int, atts []*Attribute) {
+			ev := event{Pos: pos}
+			for _, a := range atts {
+				ev.Names = append(ev.Names, a.Name)
+			}
+			got = append(got, ev)
+		})
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Fatalf("ScanAttribEvents diff (-got +want):\n%s", diff)
+		}
+	}
+}
+
+func TestUnclosedAttributes(t *testing.T) {
+	as := mustRender(t, "[a]Hello [b]world")
+	want := []*Attribute{
+		{Start: 0, End: 11, Name: "a"},
+		{Start: 6, End: 11, Name: "b"},
+	}
+	if diff := cmp.Diff(as.Attributes(), want); diff != "" {
+		t.Errorf("Attributes() diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestAttributedStringJSON(t *testing.T) {
+	as := mustRender(t, `Mae: [wave size=2 slow=true]Hi[/wave][pause/]`)
+	b, err := json.Marshal(as)
+	if err != nil {
+		t.Fatalf("json.Marshal = %v", err)
+	}
+	const wantJSON = `{"text":"Mae: Hi","attributes":[` +
+		`{"start":0,"end":5,"name":"character","props":{"name":"Mae"}},` +
+		`{"start":5,"end":7,"name":"wave","props":{"size":2,"slow":true}},` +
+		`{"start":7,"end":7,"name":"pause"}]}`
+	if got := string(b); got != wantJSON {
+		t.Errorf("json.Marshal = %s, want %s", got, wantJSON)
+	}
+
+	var got AttributedString
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("json.Unmarshal = %v", err)
+	}
+	if got.String() != as.String() {
+		t.Errorf("unmarshalled String() = %q, want %q", got.String(), as.String())
+	}
+	if diff := cmp.Diff(got.Attributes(), as.Attributes()); diff != "" {
+		t.Errorf("unmarshalled Attributes() diff (-got +want):\n%s", diff)
+	}
+
+	if err := json.Unmarshal([]byte(`{"text":"x","attributes":[{"start":0,"end":2,"name":"a"}]}`), &got); err == nil {
+		t.Error("json.Unmarshal(out of range attribute) = nil error, want error")
+	}
+}
+
+func TestAttributeRangeUnits(t *testing.T) {
+	type rng struct{ Start, End Position }
+	tests := []struct {
+		input string
+		name  string
+		want  rng
+		len   Position
+	}{
+		{
+			input: "[b]abc[/b]",
+			name:  "b",
+			want:  rng{Position{0, 0, 0, 0}, Position{3, 3, 3, 3}},
+			len:   Position{3, 3, 3, 3},
+		},
+		{
+			// é as e + combining acute accent: 3 bytes, 2 runes, 1 grapheme.
+			input: "Caf[b]é[/b]!",
+			name:  "b",
+			want:  rng{Position{3, 3, 3, 3}, Position{6, 5, 5, 4}},
+			len:   Position{7, 6, 6, 5},
+		},
+		{
+			// Family emoji: 18 bytes, 5 runes, 8 UTF-16 code units, 1 grapheme.
+			input: "[wave]👨‍👩‍👧[/wave] hi",
+			name:  "wave",
+			want:  rng{Position{0, 0, 0, 0}, Position{18, 5, 8, 1}},
+			len:   Position{21, 8, 11, 4},
+		},
+		{
+			// Thumbs up with skin tone modifier.
+			input: "Mae: 👍🏽 [b]ok[/b]",
+			name:  "b",
+			want:  rng{Position{14, 8, 10, 7}, Position{16, 10, 12, 9}},
+			len:   Position{16, 10, 12, 9},
+		},
+		{
+			// Right-to-left text is measured in logical order.
+			input: "[b]שָׁלוֹם[/b] עולם",
+			name:  "b",
+			want:  rng{Position{0, 0, 0, 0}, Position{14, 7, 7, 4}},
+			len:   Position{23, 12, 12, 9},
+		},
+		{
+			// An attribute that splits a grapheme cluster is widened.
+			input: "e[b]́x[/b]",
+			name:  "b",
+			want:  rng{Position{1, 1, 1, 0}, Position{4, 3, 3, 2}},
+			len:   Position{4, 3, 3, 2},
+		},
+	}
+	for _, test := range tests {
+		as := mustRender(t, test.input)
+		atts := as.AttributesNamed(test.name)
+		if len(atts) != 1 {
+			t.Errorf("Render(%q).AttributesNamed(%q) = %v, want 1 attribute", test.input, test.name, atts)
+			continue
+		}
+		var got rng
+		got.Start, got.End = as.AttributeRange(atts[0])
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("Render(%q).AttributeRange(%s) diff (-got +want):\n%s", test.input, test.name, diff)
+		}
+		if diff := cmp.Diff(as.Len(), test.len); diff != "" {
+			t.Errorf("Render(%q).Len() diff (-got +want):\n%s", test.input, diff)
+		}
+		// Positions not precomputed are found by scanning.
+		for _, p := range []Position{got.Start, got.End, test.len} {
+			if q := as.Position(p.Byte); q.Rune != p.Rune || q.UTF16 != p.UTF16 {
+				t.Errorf("Render(%q).Position(%d) = %+v, want %+v", test.input, p.Byte, q, p)
+			}
+		}
+	}
+}
+
+func TestPositionSmileys(t *testing.T) {
+	st, err := LoadStringTableFile("testdata/Smileys-Lines.csv", "en")
+	if err != nil {
+		t.Fatalf("LoadStringTableFile = %v", err)
+	}
+	for id, row := range st.Table {
+		as, err := row.Render(nil, st.Language)
+		if err != nil {
+			t.Errorf("Render(%q) = %v", row.Text, err)
+			continue
+		}
+		// Scanning every offset agrees with the precomputed positions.
+		for _, a := range as.Attributes() {
+			start, end := as.AttributeRange(a)
+			scan := &AttributedString{str: as.String()}
+			if got := scan.Position(a.Start); got != start {
+				t.Errorf("%s: Position(%d) = %+v, want %+v", id, a.Start, got, start)
+			}
+			if got := scan.Position(a.End); got.Rune != end.Rune || got.UTF16 != end.UTF16 {
+				t.Errorf("%s: Position(%d) = %+v, want %+v", id, a.End, got, end)
+			}
+		}
+	}
+}
@@ -34,6 +34,7 @@ import (
 	"log"
 
 	"drjosh.dev/yarn"
+	"drjosh.dev/yarn/render"
 )
 
 func main() {
@@ -59,6 +60,10 @@ func main() {
 	}
 }
 
+// ansi renders lines with ANSI escape sequences that apply formatting,
+// corresponding to the BBCode-style tags from the original yarn file.
+var ansi = &render.ANSI{}
+
 // dialogueHandler implements yarn.DialogueHandler by playing the lines and
 // options on the terminal.
 type dialogueHandler struct {
@@ -72,7 +77,7 @@ func (h *dialogueHandler) Line(line yarn.Line) error {
 	if err != nil {
 		return err
 	}
-	fancyPrintln(text)
+	fmt.Println(ansi.Render(text))
 	fmt.Print("(Press ENTER to continue)")
 	fmt.Scanln()
 	// This next string is VT100 for "move to the first column, go up a line,
@@ -89,7 +94,7 @@ func (h *dialogueHandler) Options(opts []yarn.Option) (int, error) {
 			return 0, err
 		}
 		fmt.Printf("%d: ", opt.ID)
-		fancyPrintln(text)
+		fmt.Println(ansi.Render(text))
 	}
 	var choice int
 	for {
@@ -101,78 +106,3 @@ func (h *dialogueHandler) Options(opts []yarn.Option) (int, error) {
 	}
 	return choice, nil
 }
-
-// fancyPrintln prints an attributed string with ANSI escape sequences that
-// apply formatting, corresponding to the BBCode-style tags from the original
-// yarn file.
-//
-// This is needed because fmt.Println(text) would only print the string, not the
-// escape sequences needed to apply bold, underline, colour, etc.
-func fancyPrintln(text *yarn.AttributedString) {
-	str := text.String()
-	cursor := 0
-	open := make(map[*yarn.Attribute]struct{})
-	text.ScanAttribEvents(func(pos int, atts []*yarn.Attribute) {
-		if pos > cursor {
-			// Print text to this position
-			fmt.Print(str[cursor:pos])
-			cursor = pos
-		}
-		// atts either start here, end here, or both.
-		var newopen []string
-		closed := false
-		for _, a := range atts {
-			if a.Start == a.End {
-				// has no net effect; skip it
-				continue
-			}
-			if a.Start == pos {
-				open[a] = struct{}{}
-				newopen = append(newopen, a.Name)
-			}
-			if a.End == pos {
-				closed = true
-				delete(open, a)
-			}
-		}
-		if closed {
-			// Clear all character attributes
-			fmt.Print("\033[m")
-			for a := range open {
-				// Print escape codes for all the remaining open attributes
-				fmt.Print(escapes[a.Name])
-			}
-		} else {
-			// Only print escape codes for newly opened attributes
-			for _, n := range newopen {
-				fmt.Print(escapes[n])
-			}
-		}
-
-	})
-	// Print remainder
-	fmt.Println(str[cursor:])
-}
-
-// Maps style tags to ANSI escape sequences. Printing these changes the style or
-// colour. See https://en.wikipedia.org/wiki/ANSI_escape_code.
-var escapes = map[string]string{
-	"b":         "\033[1m",
-	"bold":      "\033[1m",
-	"lowint":    "\033[2m",
-	"u":         "\033[4m",
-	"underline": "\033[4m",
-	"blink":     "\033[5m",
-	"reverse":   "\033[7m",
-	"invisible": "\033[8m",
-	"strike":    "\033[9m",
-	"red":       "\033[31m",
-	"green":     "\033[32m",
-	"yellow":    "\033[33m",
-	"blue":      "\033[34m",
-	"purple":    "\033[35m",
-	"cyan":      "\033[36m",
-	"gray":      "\033[37m",
-	"grey":      "\033[37m",
-	"white":     "\033[97m",
-}
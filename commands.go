@@ -0,0 +1,170 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrCommandArgMismatch indicates the program ran a built-in command with the
+// wrong number or types of args.
+const ErrCommandArgMismatch = virtualMachineError("command arg mismatch")
+
+// CommandFunc implements a command. args contains the words of the command
+// following the command name (see SplitCommand). The function may block (for
+// example, to wait for an animation to finish), but should return promptly
+// when ctx is done, preferably with context.Cause(ctx).
+type CommandFunc func(ctx context.Context, args []string) error
+
+// CommandMap maps command names to implementations. It is similar to FuncMap,
+// but for commands: if the first word of a command matches an entry in the
+// CommandMap, the VM calls that CommandFunc instead of passing the command to
+// DialogueHandler.Command.
+//
+// The VM provides a built-in "wait" command, which pauses execution for the
+// given number of seconds (e.g. <<wait 2.5>>) as measured by the VM's Clock.
+// Built-in commands can be overridden by adding an entry with the same name.
+// Adding an entry with a nil CommandFunc causes the command to be delivered to
+// the DialogueHandler as usual.
+type CommandMap map[string]CommandFunc
+
+// lookupCommand returns the implementation of the named command: the entry in
+// vm.Commands if there is one (even if it is nil), otherwise the built-in
+// command, if there is one. vm.Commands is never modified, so it can be shared
+// between VMs.
+func (vm *VirtualMachine) lookupCommand(name string) CommandFunc {
+	if f, ok := vm.Commands[name]; ok {
+		return f
+	}
+	switch name {
+	case "wait":
+		return vm.commandWait
+	}
+	return nil
+}
+
+// commandWait implements <<wait N>>.
+func (vm *VirtualMachine) commandWait(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%w: wait takes 1 arg [got %d]", ErrCommandArgMismatch, len(args))
+	}
+	secs, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return fmt.Errorf("%w: wait duration %q is not a number", ErrCommandArgMismatch, args[0])
+	}
+	if math.IsNaN(secs) || math.IsInf(secs, 0) || secs > float64(math.MaxInt64)/float64(time.Second) {
+		return fmt.Errorf("%w: wait duration %q is out of range", ErrCommandArgMismatch, args[0])
+	}
+	if secs <= 0 {
+		return nil
+	}
+	clock := vm.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
+	select {
+	case <-clock.After(time.Duration(secs * float64(time.Second))):
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// contextHandler is implemented by handlers that can cancel commands in
+// progress, such as AsyncAdapter.
+type contextHandler interface {
+	Context() context.Context
+}
+
+// runCommandFunc calls f with a context that is done when either the context
+// passed to RunContext is done, or the handler's context is done (if the
+// handler has one).
+func (vm *VirtualMachine) runCommandFunc(f CommandFunc, args []string) error {
+	ctx, done := vm.context()
+	defer done()
+	return f(ctx, args)
+}
+
+// context returns a context for running commands and functions, which is
+// cancelled when either the context passed to RunContext is cancelled, or the
+// Handler's context (if it has one) is cancelled. done must be called when
+// the context is no longer needed.
+func (vm *VirtualMachine) context() (ctx context.Context, done func()) {
+	ctx = vm.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ch, ok := vm.Handler.(contextHandler)
+	if !ok {
+		return ctx, func() {}
+	}
+	hctx := ch.Context()
+	cctx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(hctx, func() { cancel(context.Cause(hctx)) })
+	return cctx, func() {
+		stop()
+		cancel(nil)
+	}
+}
+
+// SplitCommand splits the text of a command into words, in the same way as
+// Yarn Spinner. Words are separated by whitespace, except within double quotes.
+// Within double quotes, a backslash escapes the following character. The
+// quotes themselves are removed. For example:
+//
+//	walk Mae "the big tree" "say \"hi\""
+//
+// is split into:
+//
+//	["walk", "Mae", "the big tree", "say \"hi\""]
+func SplitCommand(cmd string) []string {
+	var (
+		words   []string
+		sb      strings.Builder
+		inWord  bool
+		inQuote bool
+		escape  bool
+	)
+	for _, r := range cmd {
+		switch {
+		case escape:
+			sb.WriteRune(r)
+			escape = false
+		case inQuote && r == '\\':
+			escape = true
+		case r == '"':
+			inQuote = !inQuote
+			inWord = true
+		case !inQuote && (r == ' ' || r == '\t' || r == '\n' || r == '\r'):
+			if inWord {
+				words = append(words, sb.String())
+				sb.Reset()
+				inWord = false
+			}
+		default:
+			sb.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, sb.String())
+	}
+	return words
+}
@@ -0,0 +1,212 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	yarnpb "drjosh.dev/yarn/bytecode"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"", nil},
+		{"wait 2", []string{"wait", "2"}},
+		{"  flip   Harley3 +1 ", []string{"flip", "Harley3", "+1"}},
+		{`walk Mae "the big tree"`, []string{"walk", "Mae", "the big tree"}},
+		{`say "\"hi\"" ""`, []string{"say", `"hi"`, ""}},
+		{`hide Collision:GermOnPorch`, []string{"hide", "Collision:GermOnPorch"}},
+	}
+	for _, test := range tests {
+		if diff := cmp.Diff(SplitCommand(test.input), test.want); diff != "" {
+			t.Errorf("SplitCommand(%q) diff (-got +want):\n%s", test.input, diff)
+		}
+	}
+}
+
+// commandProgram returns a program with a single node, Start, that runs the
+// given commands in order.
+func commandProgram(cmds ...string) *yarnpb.Program {
+	node := &yarnpb.Node{Name: "Start"}
+	for _, cmd := range cmds {
+		node.Instructions = append(node.Instructions, &yarnpb.Instruction{
+			Opcode: yarnpb.Instruction_RUN_COMMAND,
+			Operands: []*yarnpb.Operand{
+				{Value: &yarnpb.Operand_StringValue{StringValue: cmd}},
+			},
+		})
+	}
+	node.Instructions = append(node.Instructions, &yarnpb.Instruction{
+		Opcode: yarnpb.Instruction_STOP,
+	})
+	return &yarnpb.Program{
+		Nodes: map[string]*yarnpb.Node{"Start": node},
+	}
+}
+
+// commandRecorder records the commands delivered to it.
+type commandRecorder struct {
+	FakeDialogueHandler
+	commands []string
+}
+
+func (c *commandRecorder) Command(command string) error {
+	c.commands = append(c.commands, command)
+	return nil
+}
+
+func TestWaitCommand(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	handler := &commandRecorder{}
+	vm := &VirtualMachine{
+		Program: commandProgram("before", "wait 1.5", "after"),
+		Handler: handler,
+		Vars:    NewMapVariableStorage(),
+		Clock:   clock,
+	}
+	errCh := make(chan error)
+	go func() { errCh <- vm.Run("Start") }()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	if got, want := clock.Waiters(), 1; got != want {
+		t.Errorf("after 1s, clock.Waiters() = %d, want %d", got, want)
+	}
+	clock.Advance(500 * time.Millisecond)
+
+	if err := <-errCh; err != nil {
+		t.Errorf("vm.Run(Start) = %v", err)
+	}
+	if diff := cmp.Diff(handler.commands, []string{"before", "after"}); diff != "" {
+		t.Errorf("commands diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestWaitCommandBadArgs(t *testing.T) {
+	for _, cmd := range []string{"wait", "wait 1 2", "wait soon", "wait NaN", "wait Inf", "wait 1e300"} {
+		vm := &VirtualMachine{
+			Program: commandProgram(cmd),
+			Handler: FakeDialogueHandler{},
+			Vars:    NewMapVariableStorage(),
+			Clock:   NewFakeClock(time.Unix(0, 0)),
+		}
+		if err := vm.Run("Start"); !errors.Is(err, ErrCommandArgMismatch) {
+			t.Errorf("%q: vm.Run(Start) = %v, want %v", cmd, err, ErrCommandArgMismatch)
+		}
+	}
+}
+
+func TestWaitCommandOverridden(t *testing.T) {
+	handler := &commandRecorder{}
+	var ran []string
+	vm := &VirtualMachine{
+		Program: commandProgram("wait 2", "wave"),
+		Handler: handler,
+		Vars:    NewMapVariableStorage(),
+		Commands: CommandMap{
+			"wait": nil, // deliver to the handler instead
+			"wave": func(context.Context, []string) error {
+				ran = append(ran, "wave")
+				return nil
+			},
+		},
+	}
+	if err := vm.Run("Start"); err != nil {
+		t.Errorf("vm.Run(Start) = %v", err)
+	}
+	if diff := cmp.Diff(handler.commands, []string{"wait 2"}); diff != "" {
+		t.Errorf("handler commands diff (-got +want):\n%s", diff)
+	}
+	if diff := cmp.Diff(ran, []string{"wave"}); diff != "" {
+		t.Errorf("CommandMap commands diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestCommandMapShared(t *testing.T) {
+	cm := CommandMap{
+		"wave": func(context.Context, []string) error { return nil },
+	}
+	for range 2 {
+		clock := NewFakeClock(time.Unix(0, 0))
+		vm := &VirtualMachine{
+			Program:  commandProgram("wait 1", "wave"),
+			Handler:  &commandRecorder{},
+			Vars:     NewMapVariableStorage(),
+			Commands: cm,
+			Clock:    clock,
+		}
+		errc := make(chan error, 1)
+		go func() { errc <- vm.Run("Start") }()
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+		if err := <-errc; err != nil {
+			t.Errorf("vm.Run(Start) = %v", err)
+		}
+	}
+	if len(cm) != 1 || cm["wait"] != nil {
+		t.Errorf("CommandMap has %d entries after running, want it unchanged", len(cm))
+	}
+}
+
+func TestWaitCommandContextCancelled(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	vm := &VirtualMachine{
+		Program: commandProgram("wait 10"),
+		Handler: FakeDialogueHandler{},
+		Vars:    NewMapVariableStorage(),
+		Clock:   clock,
+	}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	errCh := make(chan error)
+	go func() { errCh <- vm.RunContext(ctx, "Start") }()
+
+	clock.BlockUntil(1)
+	cancel(errDummy)
+
+	if err := <-errCh; !errors.Is(err, errDummy) {
+		t.Errorf("vm.RunContext(ctx, Start) = %v, want %v", err, errDummy)
+	}
+}
+
+func TestWaitCommandAsyncAbort(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	ah := &FakeAsyncDialogueHandler{}
+	aa := NewAsyncAdapter(ah)
+	ah.AsyncAdapter = aa
+	vm := &VirtualMachine{
+		Program: commandProgram("wait 10"),
+		Handler: aa,
+		Vars:    NewMapVariableStorage(),
+		Clock:   clock,
+	}
+	errCh := make(chan error)
+	go func() { errCh <- vm.Run("Start") }()
+
+	clock.BlockUntil(1)
+	if err := aa.Abort(errDummy); err != nil {
+		t.Errorf("aa.Abort(errDummy) = %v", err)
+	}
+
+	if err := <-errCh; !errors.Is(err, errDummy) {
+		t.Errorf("vm.Run(Start) = %v, want %v", err, errDummy)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var (
+	_ TypedVariableStorage     = &ComputedVariableStorage{}
+	_ FlushableVariableStorage = &ComputedVariableStorage{}
+	_ FallibleVariableStorage  = &ComputedVariableStorage{}
+)
+
+// VariableGetter computes the value of a variable. It returns false if the
+// variable has no value (in which case the fallback storage is not
+// consulted).
+type VariableGetter func(name string) (value any, ok bool)
+
+// VariableSetter is called to store a value in a computed variable.
+type VariableSetter func(name string, value any) error
+
+// readOnlyChecker is implemented by storages that can have read-only
+// variables. The VM checks IsReadOnly before storing a variable.
+type readOnlyChecker interface {
+	IsReadOnly(name string) bool
+}
+
+type computedVar struct {
+	get VariableGetter
+	set VariableSetter // nil = read-only
+}
+
+// ComputedVariableStorage is a VariableStorage where some variables are
+// backed by Go functions, so that dialogue can read game state (such as
+// $time_of_day or $player_gold) directly. Variables can be defined
+// individually (Define) or by name prefix (DefinePrefix). Variables defined
+// without a setter are read-only: the VM stops with ErrReadOnlyVariable if
+// the dialogue tries to store a value in one. All other variables are read
+// from and written to the Fallback storage.
+//
+// Errors returned by setters (and attempts to set read-only variables outside
+// the VM) are reported by Err.
+type ComputedVariableStorage struct {
+	// Fallback stores all the variables that aren't computed.
+	Fallback VariableStorage
+
+	mu       sync.RWMutex
+	vars     map[string]computedVar
+	prefixes map[string]computedVar
+	err      error
+}
+
+// NewComputedVariableStorage returns a new ComputedVariableStorage with no
+// computed variables, storing everything else in fallback.
+func NewComputedVariableStorage(fallback VariableStorage) *ComputedVariableStorage {
+	return &ComputedVariableStorage{Fallback: fallback}
+}
+
+// Define defines a computed variable. If set is nil, the variable is
+// read-only.
+func (c *ComputedVariableStorage) Define(name string, get VariableGetter, set VariableSetter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.vars == nil {
+		c.vars = make(map[string]computedVar)
+	}
+	c.vars[name] = computedVar{get: get, set: set}
+}
+
+// DefinePrefix defines computed variables for all names beginning with
+// prefix (for example, "$inventory_"). Variables defined with Define take
+// precedence, followed by the longest matching prefix. If set is nil, the
+// variables are read-only.
+func (c *ComputedVariableStorage) DefinePrefix(prefix string, get VariableGetter, set VariableSetter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.prefixes == nil {
+		c.prefixes = make(map[string]computedVar)
+	}
+	c.prefixes[prefix] = computedVar{get: get, set: set}
+}
+
+// lookup finds the computed variable for name, if any.
+func (c *ComputedVariableStorage) lookup(name string) (computedVar, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if cv, ok := c.vars[name]; ok {
+		return cv, true
+	}
+	best, found := "", false
+	for p := range c.prefixes {
+		if strings.HasPrefix(name, p) && (!found || len(p) > len(best)) {
+			best, found = p, true
+		}
+	}
+	return c.prefixes[best], found
+}
+
+// IsReadOnly reports whether name is a computed variable without a setter.
+func (c *ComputedVariableStorage) IsReadOnly(name string) bool {
+	cv, ok := c.lookup(name)
+	return ok && cv.set == nil
+}
+
+// GetValue gets the value of a variable, from its getter if it is computed,
+// or otherwise from Fallback.
+func (c *ComputedVariableStorage) GetValue(name string) (value any, found bool) {
+	if cv, ok := c.lookup(name); ok {
+		return cv.get(name)
+	}
+	return c.Fallback.GetValue(name)
+}
+
+// SetValue sets the value of a variable, using its setter if it is computed,
+// or otherwise in Fallback.
+func (c *ComputedVariableStorage) SetValue(name string, value any) {
+	cv, ok := c.lookup(name)
+	if !ok {
+		c.Fallback.SetValue(name, value)
+		return
+	}
+	var err error
+	if cv.set == nil {
+		err = fmt.Errorf("%w %q", ErrReadOnlyVariable, name)
+	} else if err = cv.set(name, value); err != nil {
+		err = fmt.Errorf("setting %q: %w", name, err)
+	}
+	if err != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.err == nil {
+			c.err = err
+		}
+	}
+}
+
+// GetTypedValue is like GetValue, but returns a Value. Computed values that
+// are not convertible to Value are reported as not found.
+func (c *ComputedVariableStorage) GetTypedValue(name string) (value Value, found bool) {
+	if _, ok := c.lookup(name); !ok {
+		if tv, ok := c.Fallback.(TypedVariableStorage); ok {
+			return tv.GetTypedValue(name)
+		}
+	}
+	x, found := c.GetValue(name)
+	if !found {
+		return Value{}, false
+	}
+	return valueOrOpaque(x), true
+}
+
+// SetTypedValue is like SetValue, but takes a Value. Setters receive values as
+// returned by Value.Interface.
+func (c *ComputedVariableStorage) SetTypedValue(name string, value Value) {
+	if _, ok := c.lookup(name); !ok {
+		if tv, ok := c.Fallback.(TypedVariableStorage); ok {
+			tv.SetTypedValue(name, value)
+			return
+		}
+	}
+	c.SetValue(name, value.Interface())
+}
+
+// Delete deletes values from Fallback, if it has a Delete method. Computed
+// variables cannot be deleted.
+func (c *ComputedVariableStorage) Delete(names ...string) {
+	if del, ok := c.Fallback.(deletableVariableStorage); ok {
+		del.Delete(names...)
+	}
+}
+
+// ClearErr clears the error returned by Err (but not any error from
+// Fallback).
+func (c *ComputedVariableStorage) ClearErr() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = nil
+}
+
+// Flush flushes Fallback, if it is a FlushableVariableStorage.
+func (c *ComputedVariableStorage) Flush() error {
+	if fv, ok := c.Fallback.(FlushableVariableStorage); ok {
+		return fv.Flush()
+	}
+	return nil
+}
+
+// Err returns the first error from a setter (or from setting a read-only
+// variable) since the storage was created or ClearErr was called. If there is
+// no such error, and Fallback is a FallibleVariableStorage, Err returns the
+// error from Fallback.
+func (c *ComputedVariableStorage) Err() error {
+	c.mu.Lock()
+	err := c.err
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if fv, ok := c.Fallback.(FallibleVariableStorage); ok {
+		return fv.Err()
+	}
+	return nil
+}
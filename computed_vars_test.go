@@ -0,0 +1,90 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestComputedVariableStorage(t *testing.T) {
+	gold := 10
+	inventory := map[string]int{"apple": 2}
+	c := NewComputedVariableStorage(NewMapVariableStorage())
+	c.Define("$time_of_day", func(string) (any, bool) { return "morning", true }, nil)
+	c.Define("$player_gold", func(string) (any, bool) { return gold, true }, func(_ string, v any) error {
+		n, err := ConvertToInt(v)
+		gold = n
+		return err
+	})
+	c.DefinePrefix("$inventory_", func(name string) (any, bool) {
+		n, ok := inventory[strings.TrimPrefix(name, "$inventory_")]
+		return n, ok
+	}, nil)
+
+	if got, ok := c.GetValue("$time_of_day"); !ok || got != "morning" {
+		t.Errorf("GetValue($time_of_day) = %v, %t, want morning, true", got, ok)
+	}
+	if got, ok := c.GetTypedValue("$inventory_apple"); !ok || !got.Equal(NumberValue(2)) {
+		t.Errorf("GetTypedValue($inventory_apple) = %v, %t, want 2, true", got, ok)
+	}
+	if got, ok := c.GetValue("$inventory_pear"); ok {
+		t.Errorf("GetValue($inventory_pear) = %v, %t, want nil, false", got, ok)
+	}
+
+	c.SetTypedValue("$player_gold", NumberValue(15))
+	if gold != 15 {
+		t.Errorf("after SetTypedValue($player_gold, 15), gold = %d, want 15", gold)
+	}
+	c.SetValue("$other", "fallback")
+	if got, ok := c.Fallback.GetValue("$other"); !ok || got != "fallback" {
+		t.Errorf("Fallback.GetValue($other) = %v, %t, want fallback, true", got, ok)
+	}
+
+	if !c.IsReadOnly("$inventory_apple") || c.IsReadOnly("$player_gold") || c.IsReadOnly("$other") {
+		t.Error("IsReadOnly gave the wrong answer")
+	}
+	c.SetValue("$time_of_day", "evening")
+	if err := c.Err(); !errors.Is(err, ErrReadOnlyVariable) {
+		t.Errorf("Err() = %v, want %v", err, ErrReadOnlyVariable)
+	}
+	if err := c.Err(); !errors.Is(err, ErrReadOnlyVariable) {
+		t.Errorf("second Err() = %v, want %v", err, ErrReadOnlyVariable)
+	}
+	c.ClearErr()
+	if err := c.Err(); err != nil {
+		t.Errorf("after ClearErr, Err() = %v, want nil", err)
+	}
+}
+
+func TestComputedVariableStorageVM(t *testing.T) {
+	c := NewComputedVariableStorage(NewMapVariableStorage())
+	c.Define("$x", func(string) (any, bool) { return 42, true }, nil)
+	for _, vars := range []VariableStorage{c, NewLayeredVariableStorage(c)} {
+		vm := &VirtualMachine{
+			Program: loopProgram(1),
+			Handler: FakeDialogueHandler{},
+			Vars:    vars,
+		}
+		err := vm.Run("Start")
+		if !errors.Is(err, ErrReadOnlyVariable) {
+			t.Errorf("vm.Run(Start) = %v, want %v", err, ErrReadOnlyVariable)
+		}
+		if err == nil || !strings.Contains(err.Error(), `"$x"`) {
+			t.Errorf("vm.Run(Start) = %v, want error mentioning $x", err)
+		}
+	}
+}
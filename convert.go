@@ -15,20 +15,24 @@
 package yarn
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"strconv"
+	"strings"
 
 	yarnpb "drjosh.dev/yarn/bytecode"
 )
 
 // ConvertToBool attempts conversion of the standard Yarn Spinner VM types
-// (bool, number, string, null) to bool.
+// (bool, number, string, null, or Value) to bool.
 func ConvertToBool(x interface{}) (bool, error) {
 	if x == nil {
 		return false, nil
 	}
 	switch x := x.(type) {
+	case Value:
+		return x.Bool(), nil
 	case bool:
 		return x, nil
 	case float32:
@@ -44,13 +48,16 @@ func ConvertToBool(x interface{}) (bool, error) {
 	}
 }
 
-// ConvertToInt attempts conversion of the standard Yarn Spinner VM types to
-// (bool, number, string, null) to int.
+// ConvertToInt attempts conversion of the standard Yarn Spinner VM types
+// (bool, number, string, null) to int. Numbers are truncated towards zero, and
+// strings are parsed with ParseNumber (so "3.5" converts to 3).
 func ConvertToInt(x interface{}) (int, error) {
 	if x == nil {
 		return 0, nil
 	}
 	switch t := x.(type) {
+	case Value:
+		return t.Int()
 	case bool:
 		if t {
 			return 1, nil
@@ -63,7 +70,11 @@ func ConvertToInt(x interface{}) (int, error) {
 	case int:
 		return t, nil
 	case string:
-		return strconv.Atoi(t)
+		f, err := ParseNumber(t)
+		if err != nil {
+			return 0, err
+		}
+		return int(f), nil
 	default:
 		if t == nil {
 			return 0, nil
@@ -79,6 +90,8 @@ func ConvertToFloat32(x interface{}) (float32, error) {
 		return 0, nil
 	}
 	switch t := x.(type) {
+	case Value:
+		return t.Float32()
 	case bool:
 		if t {
 			return 1, nil
@@ -91,7 +104,7 @@ func ConvertToFloat32(x interface{}) (float32, error) {
 	case int:
 		return float32(t), nil
 	case string:
-		y, err := strconv.ParseFloat(t, 32)
+		y, err := parseNumber(t, 32)
 		if err != nil {
 			return 0, err
 		}
@@ -111,6 +124,8 @@ func ConvertToFloat64(x interface{}) (float64, error) {
 		return 0, nil
 	}
 	switch t := x.(type) {
+	case Value:
+		return t.Number()
 	case bool:
 		if t {
 			return 1, nil
@@ -123,7 +138,7 @@ func ConvertToFloat64(x interface{}) (float64, error) {
 	case int:
 		return float64(t), nil
 	case string:
-		return strconv.ParseFloat(t, 64)
+		return ParseNumber(t)
 	default:
 		if t == nil {
 			return 0, nil
@@ -133,20 +148,197 @@ func ConvertToFloat64(x interface{}) (float64, error) {
 }
 
 // ConvertToString converts a value to a string, in a way that matches what Yarn
-// Spinner does. nil becomes "null", and booleans are title-cased.
+// Spinner does. nil becomes "null", booleans are title-cased, and numbers are
+// formatted with FormatNumber.
 func ConvertToString(x interface{}) string {
-	if x == nil {
+	switch x := x.(type) {
+	case nil:
 		return "null"
-	}
-	if x, ok := x.(bool); ok {
+	case Value:
+		return x.String()
+	case bool:
 		if x {
 			return "True"
 		}
 		return "False"
+	case float32:
+		return formatNumber(float64(x), 32)
+	case float64:
+		return formatNumber(x, 64)
+	case int:
+		return strconv.Itoa(x)
 	}
 	return fmt.Sprint(x)
 }
 
+// FormatNumber formats a number the same way as Yarn Spinner, which uses the
+// C# (.NET Core 3.0 and later) invariant culture float.ToString(). This is
+// the shortest string that parses back to the same float32, in fixed-point
+// notation unless the exponent is large or small. For example:
+//
+//	1000000     -> "1000000"
+//	10000000    -> "1E+07"
+//	0.0001      -> "0.0001"
+//	0.00001     -> "1E-05"
+//	0.1 + 0.2   -> "0.3" (as float32 arithmetic)
+//	+Inf, -Inf  -> "Infinity", "-Infinity"
+//	NaN         -> "NaN"
+func FormatNumber(f float32) string {
+	return formatNumber(float64(f), 32)
+}
+
+// formatNumber implements FormatNumber for either float32 (bitSize 32) or
+// float64 (bitSize 64) values.
+func formatNumber(f float64, bitSize int) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+
+	// Start with the shortest round-trip digits, from "d.ddde±xx".
+	e := strconv.FormatFloat(f, 'e', -1, bitSize)
+	var sb strings.Builder
+	if e[0] == '-' {
+		sb.WriteByte('-')
+		e = e[1:]
+	}
+	mant, exps, _ := strings.Cut(e, "e")
+	digits := strings.Replace(mant, ".", "", 1)
+	exp, _ := strconv.Atoi(exps)
+	if digits == "0" {
+		sb.WriteByte('0')
+		return sb.String()
+	}
+
+	// .NET switches to scientific notation when the decimal point would be
+	// after more than max(len(digits), precision) digits, or when there
+	// would be more than 4 leading zeroes. precision is 7 for float and 15
+	// for double (the "G" format's traditional default precisions).
+	precision := 7
+	if bitSize == 64 {
+		precision = 15
+	}
+	scale := exp + 1 // position of the decimal point within digits
+	if scale > max(len(digits), precision) || scale < -3 {
+		sb.WriteByte(digits[0])
+		if len(digits) > 1 {
+			sb.WriteByte('.')
+			sb.WriteString(digits[1:])
+		}
+		sb.WriteString("E")
+		if exp < 0 {
+			sb.WriteByte('-')
+			exp = -exp
+		} else {
+			sb.WriteByte('+')
+		}
+		if exp < 10 {
+			sb.WriteByte('0')
+		}
+		sb.WriteString(strconv.Itoa(exp))
+		return sb.String()
+	}
+
+	switch {
+	case scale <= 0:
+		sb.WriteString("0.")
+		sb.WriteString(strings.Repeat("0", -scale))
+		sb.WriteString(digits)
+	case scale >= len(digits):
+		sb.WriteString(digits)
+		sb.WriteString(strings.Repeat("0", scale-len(digits)))
+	default:
+		sb.WriteString(digits[:scale])
+		sb.WriteByte('.')
+		sb.WriteString(digits[scale:])
+	}
+	return sb.String()
+}
+
+// ParseNumber parses a string as a number the same way as Yarn Spinner, which
+// uses the C# invariant culture float.Parse(). Compared with
+// strconv.ParseFloat, leading and trailing whitespace and thousands
+// separators (",") are allowed, "Infinity" and "NaN" are spelled out (in any
+// case, with an optional sign), hexadecimal and underscores are not allowed,
+// and out-of-range values become ±Infinity instead of an error.
+func ParseNumber(s string) (float64, error) {
+	return parseNumber(s, 64)
+}
+
+// parseNumber implements ParseNumber, rounding to either float32 (bitSize 32)
+// or float64 (bitSize 64).
+func parseNumber(s string, bitSize int) (float64, error) {
+	t := strings.Trim(s, " \t\n\v\f\r")
+	body := strings.TrimLeft(t, "+-")
+	if len(t)-len(body) > 1 {
+		return 0, fmt.Errorf("%q %w to number", s, ErrNotConvertible)
+	}
+	switch {
+	case strings.EqualFold(body, "Infinity"):
+		if t[0] == '-' {
+			return math.Inf(-1), nil
+		}
+		return math.Inf(1), nil
+	case strings.EqualFold(body, "NaN"):
+		// C# also accepts a sign ("-NaN").
+		return math.NaN(), nil
+	}
+
+	// Validate: digits and thousands separators, an optional fraction, and
+	// an optional exponent. At least one digit is required in the integer
+	// part or the fraction. This rules out everything else ParseFloat
+	// accepts (hex, underscores, "inf", ...).
+	i, ndigits, commas := 0, 0, false
+	for ; i < len(body) && (isDigit(body[i]) || (body[i] == ',' && ndigits > 0)); i++ {
+		if body[i] == ',' {
+			commas = true
+		} else {
+			ndigits++
+		}
+	}
+	if i < len(body) && body[i] == '.' {
+		for i++; i < len(body) && isDigit(body[i]); i++ {
+			ndigits++
+		}
+	}
+	if ndigits == 0 {
+		return 0, fmt.Errorf("%q %w to number", s, ErrNotConvertible)
+	}
+	if i < len(body) && (body[i] == 'e' || body[i] == 'E') {
+		i++
+		if i < len(body) && (body[i] == '+' || body[i] == '-') {
+			i++
+		}
+		start := i
+		for i < len(body) && isDigit(body[i]) {
+			i++
+		}
+		if i == start {
+			return 0, fmt.Errorf("%q %w to number", s, ErrNotConvertible)
+		}
+	}
+	if i != len(body) {
+		return 0, fmt.Errorf("%q %w to number", s, ErrNotConvertible)
+	}
+	if commas {
+		t = strings.ReplaceAll(t, ",", "")
+	}
+
+	// Out of range values are ±Inf (or ±0), as they are in C#. That's also
+	// what ParseFloat returns alongside ErrRange.
+	f, err := strconv.ParseFloat(t, bitSize)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return 0, fmt.Errorf("%q %w to number: %w", s, ErrNotConvertible, err)
+	}
+	return f, nil
+}
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
 // operandToInt is a helper for turning a number value into an int.
 func operandToInt(op *yarnpb.Operand) (int, error) {
 	if op == nil {
@@ -0,0 +1,172 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// The expected strings in these tests follow float.ToString() and
+// double.ToString() with the invariant culture, in .NET Core 3.0 and later.
+func TestFormatNumber(t *testing.T) {
+	tenth, fifth := float32(0.1), float32(0.2)
+	tests := []struct {
+		f    float32
+		want string
+	}{
+		{0, "0"},
+		{float32(math.Copysign(0, -1)), "-0"},
+		{1, "1"},
+		{-1.5, "-1.5"},
+		{45.1, "45.1"},
+		{tenth + fifth, "0.3"},
+		{1.0 / 3, "0.33333334"},
+		{100, "100"},
+		{1234567, "1234567"},
+		{1e6, "1000000"},
+		{1e7, "1E+07"},
+		{-1e7, "-1E+07"},
+		{12345678, "12345678"},
+		{16777216, "16777216"},
+		{123456789, "1.2345679E+08"},
+		{1e20, "1E+20"},
+		{math.MaxFloat32, "3.4028235E+38"},
+		{0.001, "0.001"},
+		{0.0001, "0.0001"},
+		{0.000123, "0.000123"},
+		{0.00001, "1E-05"},
+		{-1.5e-10, "-1.5E-10"},
+		{math.SmallestNonzeroFloat32, "1E-45"},
+		{float32(math.Inf(1)), "Infinity"},
+		{float32(math.Inf(-1)), "-Infinity"},
+		{float32(math.NaN()), "NaN"},
+	}
+	for _, test := range tests {
+		if got := FormatNumber(test.f); got != test.want {
+			t.Errorf("FormatNumber(%v) = %q, want %q", test.f, got, test.want)
+		}
+		if got := ConvertToString(test.f); got != test.want {
+			t.Errorf("ConvertToString(float32(%v)) = %q, want %q", test.f, got, test.want)
+		}
+		if got := NumberValue(float64(test.f)).String(); got != test.want {
+			t.Errorf("NumberValue(%v).String() = %q, want %q", test.f, got, test.want)
+		}
+	}
+}
+
+func TestFormatNumber64(t *testing.T) {
+	tenth, fifth := 0.1, 0.2
+	tests := []struct {
+		f    float64
+		want string
+	}{
+		{0, "0"},
+		{45.1, "45.1"},
+		{tenth + fifth, "0.30000000000000004"},
+		{123456789, "123456789"},
+		{123456789012345, "123456789012345"},
+		{1e15, "1E+15"},
+		{1234567890123456, "1234567890123456"},
+		{0.0001, "0.0001"},
+		{0.00001, "1E-05"},
+		{1e-100, "1E-100"},
+		{math.MaxFloat64, "1.7976931348623157E+308"},
+		{math.Inf(-1), "-Infinity"},
+	}
+	for _, test := range tests {
+		if got := ConvertToString(test.f); got != test.want {
+			t.Errorf("ConvertToString(%v) = %q, want %q", test.f, got, test.want)
+		}
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    float64
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"42", 42, false},
+		{" 42\t", 42, false},
+		{"3.5", 3.5, false},
+		{"-3.5", -3.5, false},
+		{"+7", 7, false},
+		{".5", 0.5, false},
+		{"5.", 5, false},
+		{"1,000,000", 1e6, false},
+		{"1E+07", 1e7, false},
+		{"1e-5", 1e-5, false},
+		{"1E+400", math.Inf(1), false},
+		{"Infinity", math.Inf(1), false},
+		{"-infinity", math.Inf(-1), false},
+		{"NaN", math.NaN(), false},
+		{"-NaN", math.NaN(), false},
+		{"+nan", math.NaN(), false},
+		{"--NaN", 0, true},
+		{"", 0, true},
+		{"  ", 0, true},
+		{"abc", 0, true},
+		{"3.5abc", 0, true},
+		{"0x10", 0, true},
+		{"1_000", 0, true},
+		{"inf", 0, true},
+		{"1e", 0, true},
+		{"--1", 0, true},
+		{".", 0, true},
+	}
+	for _, test := range tests {
+		got, err := ParseNumber(test.s)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseNumber(%q) error = %v, want error %t", test.s, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, ErrNotConvertible) {
+				t.Errorf("ParseNumber(%q) error = %v, want %v", test.s, err, ErrNotConvertible)
+			}
+			continue
+		}
+		if got != test.want && !(math.IsNaN(got) && math.IsNaN(test.want)) {
+			t.Errorf("ParseNumber(%q) = %v, want %v", test.s, got, test.want)
+		}
+	}
+}
+
+func TestConvertStringToNumber(t *testing.T) {
+	if got, err := ConvertToInt("3.5"); err != nil || got != 3 {
+		t.Errorf("ConvertToInt(3.5) = %d, %v, want 3, nil", got, err)
+	}
+	if got, err := ConvertToInt("-2.9"); err != nil || got != -2 {
+		t.Errorf("ConvertToInt(-2.9) = %d, %v, want -2, nil", got, err)
+	}
+	if got, err := StringValue(" 1,024 ").Int(); err != nil || got != 1024 {
+		t.Errorf("StringValue(1,024).Int() = %d, %v, want 1024, nil", got, err)
+	}
+	if got, err := ConvertToFloat32("1E+39"); err != nil || !math.IsInf(float64(got), 1) {
+		t.Errorf("ConvertToFloat32(1E+39) = %v, %v, want +Inf, nil", got, err)
+	}
+	if _, err := ConvertToFloat64("twelve"); !errors.Is(err, ErrNotConvertible) {
+		t.Errorf("ConvertToFloat64(twelve) error = %v, want %v", err, ErrNotConvertible)
+	}
+
+	// String + number concatenation uses the same formatting.
+	got, err := funcAdd("x", float32(1e7))
+	if err != nil || got != "x1E+07" {
+		t.Errorf("funcAdd(x, 1e7) = %v, %v, want x1E+07, nil", got, err)
+	}
+}
@@ -20,6 +20,22 @@ type Line struct {
 	ID string
 	// Values that should be interpolated into the user-facing text.
 	Substitutions []string
+	// The same values as Substitutions, before conversion to strings. This
+	// allows StringTable.Render to format numbers for the language.
+	Values []Value
+
+	// The remaining fields are only set if the VM has a StringTable.
+
+	// The line's hashtags (from the string table metadata), without the
+	// leading '#', except for those of the form key:value. For example,
+	// "lastline".
+	Tags []string
+	// The line's hashtags of the form key:value. For example, #emotion:happy
+	// becomes Metadata["emotion"] = "happy".
+	Metadata map[string]string
+	// The name of the character speaking the line, as in "Mae: Hello!" (see
+	// AttributedString.CharacterName). It is empty if there is no character.
+	Character string
 }
 
 // Option represents one option (among others) that the player could
@@ -39,6 +55,11 @@ type Option struct {
 	// This is false for options that the player _could_ have taken if they had
 	// satisfied some prerequisite earlier in the game.
 	IsAvailable bool
+
+	// The line delivered before the options, if it was tagged #lastline (by
+	// the Yarn Spinner compiler, so it can be shown with the options). This is
+	// only set if the VM has a StringTable.
+	LastLine *Line
 }
 
 // DialogueHandler receives events from the virtual machine.
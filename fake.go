@@ -14,7 +14,11 @@
 
 package yarn
 
-import "errors"
+import (
+	"errors"
+	"sync"
+	"time"
+)
 
 // FakeDialogueHandler implements DialogueHandler with minimal, do-nothing
 // methods. This is useful both for testing, and for satisfying the
@@ -100,3 +104,95 @@ func (f FakeAsyncDialogueHandler) NodeComplete(string) { f.AsyncAdapter.Go() }
 
 // DialogueComplete calls AsyncAdapter.Go.
 func (f FakeAsyncDialogueHandler) DialogueComplete() { f.AsyncAdapter.Go() }
+
+var _ Clock = &FakeClock{}
+
+// FakeClock implements Clock with a manually-advanced time. This is useful for
+// testing time-based commands such as wait without actually waiting. The zero
+// value is a clock stopped at the zero time.
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond // lazily created; signalled when waiters change
+	now     time.Time
+	waiters []fakeClockWaiter
+}
+
+type fakeClockWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// NewFakeClock returns a FakeClock set to the given time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the fake clock's current time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel that receives the fake time once Advance has been
+// used to move the clock forward by at least d.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeClockWaiter{
+		deadline: c.now.Add(d),
+		ch:       ch,
+	})
+	c.condLocked().Broadcast()
+	return ch
+}
+
+// Advance moves the fake clock forward by d, and fires any channels returned
+// by After whose duration has elapsed.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	remaining := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.deadline.After(c.now) {
+			remaining = append(remaining, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = remaining
+	c.condLocked().Broadcast()
+}
+
+// Waiters returns the number of channels returned by After that have not yet
+// fired.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// BlockUntil blocks until there are at least n channels returned by After
+// that have not yet fired. This is useful for synchronising a test with a VM
+// running in another goroutine.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cond := c.condLocked()
+	for len(c.waiters) < n {
+		cond.Wait()
+	}
+}
+
+func (c *FakeClock) condLocked() *sync.Cond {
+	if c.cond == nil {
+		c.cond = sync.NewCond(&c.mu)
+	}
+	return c.cond
+}
@@ -0,0 +1,456 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	yarnpb "drjosh.dev/yarn/bytecode"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// FileFormat enumerates the file formats supported by FileVariableStorage.
+type FileFormat int
+
+const (
+	// FormatJSON saves variables as a JSON object:
+	//
+	//	{"version": "...", "variables": {"$name": value, ...}}
+	FormatJSON FileFormat = iota
+
+	// FormatGob saves variables using encoding/gob.
+	FormatGob
+
+	// FormatProtobuf saves variables as a protobuf message equivalent to:
+	//
+	//	message SavedVariables {
+	//	  string version = 1;
+	//	  map<string, Yarn.Operand> variables = 2;
+	//	}
+	FormatProtobuf
+)
+
+func (f FileFormat) String() string {
+	switch f {
+	case FormatJSON:
+		return "JSON"
+	case FormatGob:
+		return "Gob"
+	case FormatProtobuf:
+		return "Protobuf"
+	}
+	return fmt.Sprintf("(invalid FileFormat %d)", f)
+}
+
+// savedVariables is the contents of a file saved by FileVariableStorage (in
+// the JSON and gob formats).
+type savedVariables struct {
+	Version   string           `json:"version"`
+	Variables map[string]Value `json:"variables"`
+}
+
+var _ TypedVariableStorage = &FileVariableStorage{}
+
+// FileVariableStorage implements VariableStorage in memory, and can load and
+// save its contents to a file. Bool, number, and string values round-trip
+// with their types intact. Saves are atomic: the contents are written to a
+// temporary file in the same directory, which is then renamed over the
+// original.
+//
+// Each save records a version string, so that saves from an older version of
+// a script can be detected after loading (see LoadedVersion).
+type FileVariableStorage struct {
+	path    string
+	format  FileFormat
+	version string
+
+	vars      *TypedMapVariableStorage
+	afterFunc func(time.Duration, func()) autosaveTimer // time.AfterFunc, or a fake in tests
+
+	mu            sync.Mutex // guards the fields below, and file writes
+	loadedVersion string     // version read by Load
+	autosave      time.Duration
+	timer         autosaveTimer // pending autosave
+	dirty         bool          // changed since last save
+	err           error         // most recent autosave error
+}
+
+// autosaveTimer is the part of *time.Timer used for autosaves.
+type autosaveTimer interface {
+	Reset(d time.Duration) bool
+	Stop() bool
+}
+
+// NewFileVariableStorage creates a new empty FileVariableStorage that saves
+// to the file at path, in the given format, recording version in each save.
+// It does not read the file; call Load to do that.
+func NewFileVariableStorage(path string, format FileFormat, version string) *FileVariableStorage {
+	return &FileVariableStorage{
+		path:    path,
+		format:  format,
+		version: version,
+		vars:    NewTypedMapVariableStorage(),
+		afterFunc: func(d time.Duration, f func()) autosaveTimer {
+			return time.AfterFunc(d, f)
+		},
+	}
+}
+
+// SetAutosave enables or disables saving automatically after each change.
+// Saves are debounced: the file is saved once delay has passed without any
+// further changes. A delay of zero or less disables autosave (any pending
+// autosave is cancelled). Errors from autosaves are available from AutosaveErr.
+func (s *FileVariableStorage) SetAutosave(delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.autosave = delay
+	if delay <= 0 && s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+}
+
+// AutosaveErr returns the error from the most recent autosave, if it failed
+// and no save has succeeded since.
+func (s *FileVariableStorage) AutosaveErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// LoadedVersion returns the version string recorded in the file read by the
+// most recent call to Load. If it differs from the version passed to
+// NewFileVariableStorage, the file was saved by a different version of the
+// script.
+func (s *FileVariableStorage) LoadedVersion() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadedVersion
+}
+
+// GetValue fetches a value from the storage, returning (nil, false) if not
+// present.
+func (s *FileVariableStorage) GetValue(name string) (value any, found bool) {
+	return s.vars.GetValue(name)
+}
+
+// SetValue sets a value in the storage. Only values convertible to Value (see
+// ValueOf) can be saved; others will cause Save to fail.
+func (s *FileVariableStorage) SetValue(name string, value any) {
+	s.vars.SetValue(name, value)
+	s.changed()
+}
+
+// GetTypedValue fetches a value from the storage, returning (null, false) if
+// not present.
+func (s *FileVariableStorage) GetTypedValue(name string) (value Value, found bool) {
+	return s.vars.GetTypedValue(name)
+}
+
+// SetTypedValue sets a value in the storage.
+func (s *FileVariableStorage) SetTypedValue(name string, value Value) {
+	s.vars.SetTypedValue(name, value)
+	s.changed()
+}
+
+// Delete deletes values from the storage.
+func (s *FileVariableStorage) Delete(names ...string) {
+	s.vars.Delete(names...)
+	s.changed()
+}
+
+// Clear empties the storage of all values.
+func (s *FileVariableStorage) Clear() {
+	s.vars.Clear()
+	s.changed()
+}
+
+// Contents returns a copy of the contents of the storage, as a regular map.
+func (s *FileVariableStorage) Contents() map[string]Value {
+	return s.vars.Contents()
+}
+
+// changed records that the contents have changed, and schedules an autosave
+// if enabled.
+func (s *FileVariableStorage) changed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirty = true
+	if s.autosave <= 0 {
+		return
+	}
+	if s.timer != nil {
+		s.timer.Reset(s.autosave)
+		return
+	}
+	s.timer = s.afterFunc(s.autosave, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.timer = nil
+		if !s.dirty {
+			return
+		}
+		s.err = s.saveLocked()
+	})
+}
+
+// SaveIfChanged saves the storage if there are unsaved changes, cancelling any
+// pending autosave.
+func (s *FileVariableStorage) SaveIfChanged() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if !s.dirty {
+		return nil
+	}
+	return s.saveLocked()
+}
+
+// Load replaces the contents of the storage with the contents of the file.
+// If the file does not exist, the error satisfies errors.Is(err,
+// fs.ErrNotExist) and the storage is unchanged.
+func (s *FileVariableStorage) Load() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("reading variables file: %w", err)
+	}
+	var saved savedVariables
+	switch s.format {
+	case FormatJSON:
+		err = json.Unmarshal(data, &saved)
+	case FormatGob:
+		err = gob.NewDecoder(bytes.NewReader(data)).Decode(&saved)
+	case FormatProtobuf:
+		err = unmarshalSavedVariables(data, &saved)
+	default:
+		err = fmt.Errorf("unsupported format %v", s.format)
+	}
+	if err != nil {
+		return fmt.Errorf("decoding variables file: %w", err)
+	}
+
+	if saved.Variables == nil {
+		saved.Variables = make(map[string]Value)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.vars.mu.Lock()
+	s.vars.m = saved.Variables
+	s.vars.other = nil
+	s.vars.mu.Unlock()
+	s.loadedVersion = saved.Version
+	s.dirty = false
+	return nil
+}
+
+// Save writes the contents of the storage to the file.
+func (s *FileVariableStorage) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveLocked()
+}
+
+func (s *FileVariableStorage) saveLocked() error {
+	s.vars.mu.RLock()
+	for name, x := range s.vars.other {
+		s.vars.mu.RUnlock()
+		return fmt.Errorf("variable %q has type %T, which cannot be saved", name, x)
+	}
+	s.vars.mu.RUnlock()
+
+	saved := savedVariables{
+		Version:   s.version,
+		Variables: s.vars.Contents(),
+	}
+	var (
+		data []byte
+		err  error
+	)
+	switch s.format {
+	case FormatJSON:
+		data, err = json.MarshalIndent(saved, "", "\t")
+	case FormatGob:
+		var buf bytes.Buffer
+		err = gob.NewEncoder(&buf).Encode(saved)
+		data = buf.Bytes()
+	case FormatProtobuf:
+		data, err = marshalSavedVariables(saved)
+	default:
+		err = fmt.Errorf("unsupported format %v", s.format)
+	}
+	if err != nil {
+		return fmt.Errorf("encoding variables: %w", err)
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return err
+	}
+	s.dirty = false
+	s.err = nil
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory as
+// path, then renames it to path.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %w", err)
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp) // no-op after a successful rename
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("writing temporary file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("syncing temporary file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing temporary file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("renaming temporary file: %w", err)
+	}
+	return nil
+}
+
+// marshalSavedVariables encodes saved in the protobuf format described by
+// FormatProtobuf. Map entries are sorted by name, so that the output is
+// deterministic.
+func marshalSavedVariables(saved savedVariables) ([]byte, error) {
+	var b []byte
+	if saved.Version != "" {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, saved.Version)
+	}
+	names := make([]string, 0, len(saved.Variables))
+	for name := range saved.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v := saved.Variables[name]
+		if v.Kind() == OpaqueKind {
+			return nil, fmt.Errorf("variable %q: opaque %T %w to protobuf", name, v.Interface(), ErrNotConvertible)
+		}
+		op, err := proto.Marshal(v.Operand())
+		if err != nil {
+			return nil, fmt.Errorf("marshaling variable %q: %w", name, err)
+		}
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, name)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendBytes(entry, op)
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b, nil
+}
+
+// unmarshalSavedVariables decodes the protobuf format described by
+// FormatProtobuf into saved.
+func unmarshalSavedVariables(b []byte, saved *savedVariables) error {
+	saved.Variables = make(map[string]Value)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			saved.Version = v
+			b = b[n:]
+		case num == 2 && typ == protowire.BytesType:
+			entry, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			name, v, err := unmarshalVariableEntry(entry)
+			if err != nil {
+				return err
+			}
+			saved.Variables[name] = v
+		default:
+			// Skip unknown fields, as protobuf does.
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return nil
+}
+
+// unmarshalVariableEntry decodes one map entry (name = 1, Operand = 2).
+func unmarshalVariableEntry(b []byte) (string, Value, error) {
+	var (
+		name string
+		op   yarnpb.Operand
+	)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return "", Value{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			if n < 0 {
+				return "", Value{}, protowire.ParseError(n)
+			}
+			name = v
+			b = b[n:]
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return "", Value{}, protowire.ParseError(n)
+			}
+			if err := proto.Unmarshal(v, &op); err != nil {
+				return "", Value{}, fmt.Errorf("unmarshaling variable %q: %w", name, err)
+			}
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return "", Value{}, protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return name, valueFromOperand(&op), nil
+}
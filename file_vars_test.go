@@ -0,0 +1,206 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestFileVariableStorageRoundTrip(t *testing.T) {
+	want := map[string]any{
+		"$bool":                         true,
+		"$number":                       float32(12.5),
+		"$string":                       "hello",
+		"$zero":                         float32(0),
+		"$empty":                        "",
+		"$Yarn.Internal.Visiting.Start": float32(2),
+		"$nan":                          float32(math.NaN()),
+		"$inf":                          float32(math.Inf(-1)),
+		"$nan_string":                   "NaN",
+	}
+	for _, format := range []FileFormat{FormatJSON, FormatGob, FormatProtobuf} {
+		t.Run(format.String(), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "vars")
+			s := NewFileVariableStorage(path, format, "v2")
+			for name, val := range want {
+				s.SetValue(name, val)
+			}
+			if err := s.Save(); err != nil {
+				t.Fatalf("Save() = %v", err)
+			}
+
+			s2 := NewFileVariableStorage(path, format, "v2")
+			if err := s2.Load(); err != nil {
+				t.Fatalf("Load() = %v", err)
+			}
+			got := make(map[string]any)
+			for name := range want {
+				v, ok := s2.GetValue(name)
+				if !ok {
+					t.Errorf("GetValue(%q) ok = false, want true", name)
+				}
+				got[name] = v
+			}
+			if diff := cmp.Diff(got, want, cmpopts.EquateNaNs()); diff != "" {
+				t.Errorf("loaded variables diff (-got +want):\n%s", diff)
+			}
+			if got, want := s2.LoadedVersion(), "v2"; got != want {
+				t.Errorf("LoadedVersion() = %q, want %q", got, want)
+			}
+
+			// No temporary files should be left behind.
+			entries, err := os.ReadDir(filepath.Dir(path))
+			if err != nil {
+				t.Fatalf("ReadDir = %v", err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("directory contains %d entries, want 1", len(entries))
+			}
+		})
+	}
+}
+
+func TestFileVariableStorageVersionMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vars.json")
+	old := NewFileVariableStorage(path, FormatJSON, "v1")
+	old.SetValue("$gold", 3)
+	if err := old.Save(); err != nil {
+		t.Fatalf("Save() = %v", err)
+	}
+
+	s := NewFileVariableStorage(path, FormatJSON, "v2")
+	if err := s.Load(); err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	if got, want := s.LoadedVersion(), "v1"; got != want {
+		t.Errorf("LoadedVersion() = %q, want %q", got, want)
+	}
+}
+
+func TestFileVariableStorageLoadMissing(t *testing.T) {
+	s := NewFileVariableStorage(filepath.Join(t.TempDir(), "nope.json"), FormatJSON, "")
+	if err := s.Load(); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Load() = %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestFileVariableStorageUnsaveable(t *testing.T) {
+	s := NewFileVariableStorage(filepath.Join(t.TempDir(), "vars.json"), FormatJSON, "")
+	s.SetValue("$weird", struct{}{})
+	if err := s.Save(); err == nil {
+		t.Error("Save() = nil, want error")
+	}
+}
+
+func TestFileVariableStorageOpaque(t *testing.T) {
+	for _, format := range []FileFormat{FormatJSON, FormatGob, FormatProtobuf} {
+		s := NewFileVariableStorage(filepath.Join(t.TempDir(), "vars"), format, "")
+		s.SetTypedValue("$item", OpaqueValue(&testItem{Name: "sword"}))
+		if err := s.Save(); !errors.Is(err, ErrNotConvertible) {
+			t.Errorf("%v: Save() = %v, want %v", format, err, ErrNotConvertible)
+		}
+	}
+}
+
+// fakeTimer is an autosaveTimer that only fires when fire is called.
+type fakeTimer struct {
+	f       func()
+	stopped bool
+	resets  int
+}
+
+func (t *fakeTimer) Reset(time.Duration) bool { t.resets++; return !t.stopped }
+func (t *fakeTimer) Stop() bool               { t.stopped = true; return true }
+
+func (t *fakeTimer) fire() {
+	if !t.stopped {
+		t.f()
+	}
+}
+
+func TestFileVariableStorageAutosave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vars.json")
+	s := NewFileVariableStorage(path, FormatJSON, "")
+	var timers []*fakeTimer
+	s.afterFunc = func(_ time.Duration, f func()) autosaveTimer {
+		timer := &fakeTimer{f: f}
+		timers = append(timers, timer)
+		return timer
+	}
+	s.SetAutosave(time.Second)
+	s.SetValue("$a", 1)
+	s.SetValue("$b", 2)
+
+	// The second change only resets the pending timer.
+	if len(timers) != 1 || timers[0].resets != 1 {
+		t.Fatalf("got %d timers (resets = %v), want 1 timer reset once", len(timers), timers)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("before the timer fires, Stat(%q) = %v, want %v", path, err, fs.ErrNotExist)
+	}
+	timers[0].fire()
+	if err := s.AutosaveErr(); err != nil {
+		t.Errorf("AutosaveErr() = %v", err)
+	}
+	s2 := NewFileVariableStorage(path, FormatJSON, "")
+	if err := s2.Load(); err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	if diff := cmp.Diff(s2.Contents(), map[string]Value{"$a": NumberValue(1), "$b": NumberValue(2)}); diff != "" {
+		t.Errorf("saved contents diff (-got +want):\n%s", diff)
+	}
+
+	// Disabling autosave stops the pending timer.
+	s.SetValue("$c", 3)
+	s.SetAutosave(0)
+	if !timers[1].stopped {
+		t.Error("SetAutosave(0) did not stop the pending timer")
+	}
+}
+
+func TestFileVariableStorageSaveIfChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vars.json")
+	s := NewFileVariableStorage(path, FormatJSON, "")
+	s.SetAutosave(time.Hour)
+	s.SetValue("$a", "x")
+
+	// Saving is up to the caller, not the VM.
+	if _, ok := any(s).(FlushableVariableStorage); ok {
+		t.Error("FileVariableStorage implements FlushableVariableStorage")
+	}
+	if _, ok := any(s).(FallibleVariableStorage); ok {
+		t.Error("FileVariableStorage implements FallibleVariableStorage")
+	}
+
+	if err := s.SaveIfChanged(); err != nil {
+		t.Fatalf("SaveIfChanged() = %v", err)
+	}
+	s2 := NewFileVariableStorage(path, FormatJSON, "")
+	if err := s2.Load(); err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	if got, ok := s2.GetValue("$a"); !ok || got != "x" {
+		t.Errorf("GetValue($a) = %v, %t, want x, true", got, ok)
+	}
+}
@@ -0,0 +1,300 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// ErrNoListPattern indicates that the list format function doesn't know how
+// to join lists in the language of the line.
+const ErrNoListPattern = virtualMachineError("no list pattern for language")
+
+// isFormatFuncTag reports whether a number, percent, duration, or list tag is
+// written as a format function: self-closing, and (if needsValue) with a
+// value property. Otherwise, for example [number]5[/number], it is an
+// ordinary markup tag, since these names are not reserved by Yarn Spinner.
+func isFormatFuncTag(f *parsedMarkupTag, needsValue bool) bool {
+	if f.OpeningSlash != "" || f.ClosingSlash == "" {
+		return false
+	}
+	if !needsValue {
+		return true
+	}
+	for _, prop := range f.Props {
+		if prop.Key == "value" {
+			return true
+		}
+	}
+	return false
+}
+
+// maxDecimals is the largest number of decimal places the number and percent
+// format functions allow.
+const maxDecimals = 20
+
+// renderNumberFormatFunc implements the number and percent format functions:
+//
+//	[number value={0} decimals=2 /]
+//	[percent value={0} /]
+//
+// The value is formatted for the language, with the language's grouping
+// separators, decimal separator, and digits. decimals sets the exact number
+// of decimal places, from 0 to 20 (otherwise up to 3 are shown for number,
+// and none for percent). grouping=false turns off grouping separators. For
+// percent, the value is a fraction (0.25 is formatted as 25%).
+func (b *lineRenderer) renderNumberFormatFunc(f *parsedMarkupTag, percent bool) error {
+	x, err := b.numberValue(f)
+	if err != nil {
+		return err
+	}
+	var opts []number.Option
+	decimals, ok, err := b.intProp(f, "decimals")
+	if err != nil {
+		return err
+	}
+	if ok {
+		if decimals < 0 || decimals > maxDecimals {
+			return fmt.Errorf("property \"decimals\" of %q must be between 0 and %d [got %d]", f.Name, maxDecimals, decimals)
+		}
+		opts = append(opts, number.MinFractionDigits(decimals), number.MaxFractionDigits(decimals))
+	}
+	grouping, ok, err := b.boolProp(f, "grouping")
+	if err != nil {
+		return err
+	}
+	if ok && !grouping {
+		opts = append(opts, number.NoSeparator())
+	}
+	p := message.NewPrinter(b.lang)
+	if percent {
+		b.builder.WriteString(p.Sprint(number.Percent(x, opts...)))
+	} else {
+		b.builder.WriteString(p.Sprint(number.Decimal(x, opts...)))
+	}
+	return nil
+}
+
+// formatLocalNumber formats a number for the language, with the same number of
+// decimal places as Value.String. Infinities, NaN, and numbers that
+// Value.String formats in scientific notation are not localised.
+func formatLocalNumber(lang language.Tag, v Value) string {
+	s := v.String()
+	x, err := v.Number()
+	if err != nil || math.IsInf(x, 0) || math.IsNaN(x) || strings.ContainsRune(s, 'E') {
+		return s
+	}
+	_, frac, _ := strings.Cut(s, ".")
+	return message.NewPrinter(lang).Sprint(number.Decimal(x,
+		number.MinFractionDigits(len(frac)),
+		number.MaxFractionDigits(len(frac)),
+	))
+}
+
+// renderDurationFormatFunc implements the duration format function:
+//
+//	[duration value={0} /]
+//
+// The value is a number of seconds, which is rounded to the nearest second
+// and formatted as hours, minutes, and seconds (h:mm:ss), or minutes and
+// seconds (m:ss) if less than an hour, using the language's digits.
+func (b *lineRenderer) renderDurationFormatFunc(f *parsedMarkupTag) error {
+	x, err := b.numberValue(f)
+	if err != nil {
+		return err
+	}
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return fmt.Errorf("duration value %v is not finite", x)
+	}
+	secs := int64(math.Round(x))
+	if secs < 0 {
+		b.builder.WriteString("-")
+		secs = -secs
+	}
+	p := message.NewPrinter(b.lang)
+	h, m, s := secs/3600, secs/60%60, secs%60
+	if h > 0 {
+		b.builder.WriteString(p.Sprint(number.Decimal(h, number.NoSeparator())))
+		b.builder.WriteString(":")
+		b.builder.WriteString(p.Sprint(number.Decimal(m, number.MinIntegerDigits(2))))
+	} else {
+		b.builder.WriteString(p.Sprint(number.Decimal(m)))
+	}
+	b.builder.WriteString(":")
+	b.builder.WriteString(p.Sprint(number.Decimal(s, number.MinIntegerDigits(2))))
+	return nil
+}
+
+// renderListFormatFunc implements the list format function:
+//
+//	[list a={0} b={1} c="the dog" /]
+//
+// The values of the properties (in the order written) are joined in the way
+// of the language, for example "{0}, {1} and the dog" in British English.
+// Empty values are skipped. Only some languages are supported (see
+// listPatterns); for others, it returns ErrNoListPattern. A list
+// MarkupProcessor can be used to support them.
+func (b *lineRenderer) renderListFormatFunc(f *parsedMarkupTag) error {
+	p, err := listPatternFor(b.lang)
+	if err != nil {
+		return err
+	}
+	var items []string
+	for _, prop := range f.Props {
+		v, err := b.evalStringOrSubst(prop.Value)
+		if err != nil {
+			return err
+		}
+		if v != "" {
+			items = append(items, v)
+		}
+	}
+	b.builder.WriteString(p.join(items))
+	return nil
+}
+
+// numberValue returns the "value" property of a format function as a number.
+func (b *lineRenderer) numberValue(f *parsedMarkupTag) (float64, error) {
+	input, err := b.evalValueValue(f)
+	if err != nil {
+		return 0, err
+	}
+	return ParseNumber(input)
+}
+
+// intProp returns the value of an optional integer property.
+func (b *lineRenderer) intProp(f *parsedMarkupTag, key string) (n int, ok bool, err error) {
+	v, ok, err := b.optionalProp(f, key)
+	if !ok || err != nil {
+		return 0, ok, err
+	}
+	if v.Kind() != NumberKind {
+		return 0, true, fmt.Errorf("property %q of %q must be a number [got %v]", key, f.Name, v.Kind())
+	}
+	n, err = v.Int()
+	return n, true, err
+}
+
+// boolProp returns the value of an optional bool property.
+func (b *lineRenderer) boolProp(f *parsedMarkupTag, key string) (x, ok bool, err error) {
+	v, ok, err := b.optionalProp(f, key)
+	if !ok || err != nil {
+		return false, ok, err
+	}
+	if v.Kind() != BoolKind {
+		return false, true, fmt.Errorf("property %q of %q must be a bool [got %v]", key, f.Name, v.Kind())
+	}
+	return v.Bool(), true, nil
+}
+
+// optionalProp evaluates the property called key, if f has one.
+func (b *lineRenderer) optionalProp(f *parsedMarkupTag, key string) (Value, bool, error) {
+	for _, prop := range f.Props {
+		if prop.Key == key {
+			v, err := b.evalPropValue(prop.Value)
+			return v, true, err
+		}
+	}
+	return Value{}, false, nil
+}
+
+// listPattern is a CLDR list pattern ("standard" type). Lists of two items
+// use pair; longer lists use start between the first two items, end between
+// the last two, and middle between the others. Each is a separator, that is,
+// the pattern with "{0}" and "{1}" removed.
+type listPattern struct {
+	pair, start, middle, end string
+}
+
+func (p listPattern) join(items []string) string {
+	switch len(items) {
+	case 0:
+		return ""
+	case 1:
+		return items[0]
+	case 2:
+		return items[0] + p.pair + items[1]
+	}
+	var sb strings.Builder
+	last := len(items) - 1
+	for i, item := range items {
+		switch i {
+		case 0:
+		case 1:
+			sb.WriteString(p.start)
+		case last:
+			sb.WriteString(p.end)
+		default:
+			sb.WriteString(p.middle)
+		}
+		sb.WriteString(item)
+	}
+	return sb.String()
+}
+
+// listPatterns contains the standard list patterns from CLDR for some common
+// languages. The list format function fails with ErrNoListPattern for other
+// languages, rather than joining with English words.
+var listPatterns = map[string]listPattern{
+	"ca":     {" i ", ", ", ", ", " i "},
+	"cs":     {" a ", ", ", ", ", " a "},
+	"da":     {" og ", ", ", ", ", " og "},
+	"de":     {" und ", ", ", ", ", " und "},
+	"el":     {" και ", ", ", ", ", " και "},
+	"en":     {" and ", ", ", ", ", ", and "},
+	"en-001": {" and ", ", ", ", ", " and "},
+	"es":     {" y ", ", ", ", ", " y "},
+	"fi":     {" ja ", ", ", ", ", " ja "},
+	"fr":     {" et ", ", ", ", ", " et "},
+	"hu":     {" és ", ", ", ", ", " és "},
+	"id":     {" dan ", ", ", ", ", ", dan "},
+	"it":     {" e ", ", ", ", ", " e "},
+	"ja":     {"、", "、", "、", "、"},
+	"ko":     {" 및 ", ", ", ", ", " 및 "},
+	"nb":     {" og ", ", ", ", ", " og "},
+	"nl":     {" en ", ", ", ", ", " en "},
+	"pl":     {" i ", ", ", ", ", " i "},
+	"pt":     {" e ", ", ", ", ", " e "},
+	"ro":     {" și ", ", ", ", ", " și "},
+	"ru":     {" и ", ", ", ", ", " и "},
+	"sv":     {" och ", ", ", ", ", " och "},
+	"tr":     {" ve ", ", ", ", ", " ve "},
+	"uk":     {" і ", ", ", ", ", " і "},
+	"vi":     {" và ", ", ", ", ", " và "},
+	"zh":     {"和", "、", "、", "和"},
+}
+
+// listPatternFor returns the list pattern for a language, or its nearest
+// ancestor (for example, en-AU uses en-001, and de-AT uses de). It returns
+// ErrNoListPattern for languages not in listPatterns.
+func listPatternFor(lang language.Tag) (listPattern, error) {
+	for t := lang; !t.IsRoot(); t = t.Parent() {
+		if p, ok := listPatterns[t.String()]; ok {
+			return p, nil
+		}
+	}
+	if base, _ := lang.Base(); base.String() != "" {
+		if p, ok := listPatterns[base.String()]; ok {
+			return p, nil
+		}
+	}
+	return listPattern{}, fmt.Errorf("%w %v", ErrNoListPattern, lang)
+}
@@ -0,0 +1,198 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/text/language"
+)
+
+func TestFormatFuncs(t *testing.T) {
+	tests := []struct {
+		lang   string
+		input  string
+		substs []string
+		want   string
+	}{
+		{"en", "[number value={0}/]", []string{"1234567.891"}, "1,234,567.891"},
+		{"de", "[number value={0}/]", []string{"1234567.891"}, "1.234.567,891"},
+		{"fr", "[number value={0} decimals=2/]", []string{"1234.5"}, "1\u00a0234,50"},
+		{"en-IN", "[number value={0}/]", []string{"1234567"}, "12,34,567"},
+		{"ar", "[number value={0}/]", []string{"1234"}, "١٬٢٣٤"},
+		{"en", "[number value={0} grouping=false/]", []string{"1234.5"}, "1234.5"},
+		{"en", "[number value={0} decimals=0/] gold", []string{"2.7"}, "3 gold"},
+		{"en", "[number value={0} decimals=20/]", []string{"0.5"}, "0.50000000000000000000"},
+		{"en", "[percent value={0}/]", []string{"0.25"}, "25%"},
+		{"de", "[percent value={0}/]", []string{"0.25"}, "25\u00a0%"},
+		{"en", "[percent value={0} decimals=1/]", []string{"0.1234"}, "12.3%"},
+		{"en", "[duration value={0}/]", []string{"5"}, "0:05"},
+		{"en", "[duration value={0}/]", []string{"125.4"}, "2:05"},
+		{"en", "[duration value={0}/]", []string{"3723"}, "1:02:03"},
+		{"en", "[duration value={0}/]", []string{"-60"}, "-1:00"},
+		{"en", "[list a={0}/]", []string{"A"}, "A"},
+		{"en", "[list a={0} b={1}/]", []string{"A", "B"}, "A and B"},
+		{"en", "[list a={0} b={1} c={2}/]", []string{"A", "B", "C"}, "A, B, and C"},
+		{"en-GB", "[list a={0} b={1} c={2}/]", []string{"A", "B", "C"}, "A, B and C"},
+		{"en-AU", "[list a={0} b={1} c={2} d={3}/]", []string{"A", "B", "C", "D"}, "A, B, C and D"},
+		{"de", `[list a={0} b={1} c="der Hund"/]`, []string{"A", "B"}, "A, B und der Hund"},
+		{"ja", "[list a={0} b={1} c={2}/]", []string{"A", "B", "C"}, "A、B、C"},
+		{"zh-Hant", "[list a={0} b={1} c={2}/]", []string{"A", "B", "C"}, "A、B和C"},
+		{"en", "[list a={0} b={1} c={2}/]", []string{"A", "", "C"}, "A and C"},
+	}
+	for _, test := range tests {
+		row := &StringTableRow{Text: test.input}
+		as, err := row.Render(test.substs, language.MustParse(test.lang))
+		if err != nil {
+			t.Errorf("%s: Render(%q, %q) = %v", test.lang, test.input, test.substs, err)
+			continue
+		}
+		if got := as.String(); got != test.want {
+			t.Errorf("%s: Render(%q, %q) = %q, want %q", test.lang, test.input, test.substs, got, test.want)
+		}
+	}
+}
+
+func TestFormatFuncErrors(t *testing.T) {
+	tests := []string{
+		"[number value=x/]",
+		"[number value={0} decimals=true/]",
+		"[number value={0} grouping=1/]",
+		"[number value={0} decimals=-1/]",
+		"[number value={0} decimals=21/]",
+		"[percent value={0} decimals=100000/]",
+		"[duration value=x/]",
+	}
+	for _, input := range tests {
+		row := &StringTableRow{Text: input}
+		if _, err := row.Render([]string{"1"}, language.English); err == nil {
+			t.Errorf("Render(%q) = nil error, want error", input)
+		}
+	}
+}
+
+func TestListUnsupportedLanguage(t *testing.T) {
+	row := &StringTableRow{Text: "[list a={0} b={1}/]"}
+	for _, lang := range []string{"he", "ar", "hi"} {
+		if _, err := row.Render([]string{"A", "B"}, language.MustParse(lang)); !errors.Is(err, ErrNoListPattern) {
+			t.Errorf("%s: Render(%q) = %v, want %v", lang, row.Text, err, ErrNoListPattern)
+		}
+	}
+}
+
+func TestFormatFuncNamesAsTags(t *testing.T) {
+	tests := []struct {
+		input    string
+		wantText string
+		wantAtts []*Attribute
+	}{
+		{
+			input:    "[number]5[/number]",
+			wantText: "5",
+			wantAtts: []*Attribute{{Start: 0, End: 1, Name: "number"}},
+		},
+		{
+			input:    "[duration]x[/duration]",
+			wantText: "x",
+			wantAtts: []*Attribute{{Start: 0, End: 1, Name: "duration"}},
+		},
+		{
+			input:    "[list]a[/list]",
+			wantText: "a",
+			wantAtts: []*Attribute{{Start: 0, End: 1, Name: "list"}},
+		},
+		{
+			input:    "[percent sign=true/]%",
+			wantText: "%",
+			wantAtts: []*Attribute{{Start: 0, End: 0, Name: "percent", Props: map[string]Value{"sign": BoolValue(true)}}},
+		},
+	}
+	for _, test := range tests {
+		row := &StringTableRow{Text: test.input}
+		as, err := row.Render(nil, language.English)
+		if err != nil {
+			t.Errorf("Render(%q) = %v", test.input, err)
+			continue
+		}
+		if got := as.String(); got != test.wantText {
+			t.Errorf("Render(%q) = %q, want %q", test.input, got, test.wantText)
+		}
+		if diff := cmp.Diff(as.Attributes(), test.wantAtts); diff != "" {
+			t.Errorf("Render(%q) attributes diff (-got +want):\n%s", test.input, diff)
+		}
+	}
+}
+
+func TestLocalSubstitutions(t *testing.T) {
+	tests := []struct {
+		lang   string
+		input  string
+		values []Value
+		local  bool
+		want   string
+	}{
+		{"en", "You have {0} gold", []Value{NumberValue(1234.5)}, true, "You have 1,234.5 gold"},
+		{"de", "Du hast {0} Gold", []Value{NumberValue(1234.5)}, true, "Du hast 1.234,5 Gold"},
+		{"de", "Du hast {0} Gold", []Value{NumberValue(1234.5)}, false, "Du hast 1234.5 Gold"},
+		{"ar", "{0}", []Value{NumberValue(12)}, true, "١٢"},
+		{"de", "{0}", []Value{NumberValue(float64(float32(0.1)))}, true, "0,1"},
+		{"de", "{0}", []Value{NumberValue(1e7)}, true, "1E+07"},
+		{"de", "{0} {1} {2}", []Value{NumberValue(math.NaN()), NumberValue(math.Inf(1)), NumberValue(math.Inf(-1))}, true, "NaN Infinity -Infinity"},
+		{"en", "Year {0}", []Value{NumberValue(2026)}, false, "Year 2026"},
+		{"de", "{0} {1}", []Value{StringValue("1234.5"), BoolValue(true)}, true, "1234.5 True"},
+		{"de", `[plural value={0} one="% Apfel" other="% Äpfel"/]`, []Value{NumberValue(1234.5)}, true, "1.234,5 Äpfel"},
+		{"de", `[plural value={0} one="% Apfel" other="% Äpfel"/]`, []Value{NumberValue(1)}, true, "1 Apfel"},
+		{"de", `[select value={0} 1000="tausend" other={0}/]`, []Value{NumberValue(1000)}, true, "tausend"},
+		{"de", `[select value={0} 2000="% Stück"/]`, []Value{NumberValue(2000)}, true, "2.000 Stück"},
+	}
+	for _, test := range tests {
+		substs := make([]string, len(test.values))
+		for i, v := range test.values {
+			substs[i] = v.String()
+		}
+		st := &StringTable{
+			Language:           language.MustParse(test.lang),
+			Table:              map[string]*StringTableRow{"line:1": {ID: "line:1", Text: test.input}},
+			LocalSubstitutions: test.local,
+		}
+		as, err := st.Render(Line{ID: "line:1", Substitutions: substs, Values: test.values})
+		if err != nil {
+			t.Errorf("%s: Render(%q, %v) = %v", test.lang, test.input, test.values, err)
+			continue
+		}
+		if got := as.String(); got != test.want {
+			t.Errorf("%s: Render(%q, %v) = %q, want %q", test.lang, test.input, test.values, got, test.want)
+		}
+	}
+}
+
+func TestRenderValuesProps(t *testing.T) {
+	row := &StringTableRow{Text: "[a p={0} q={1}]x[/a]"}
+	as, err := row.RenderValues([]Value{StringValue("5"), NumberValue(5)}, language.English)
+	if err != nil {
+		t.Fatalf("RenderValues = %v", err)
+	}
+	want := map[string]Value{"p": StringValue("5"), "q": NumberValue(5)}
+	var got map[string]Value
+	as.ScanAttribEvents(func(pos int, atts []*Attribute) {
+		got = atts[0].Props
+	})
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("props diff (-got +want):\n%s", diff)
+	}
+}
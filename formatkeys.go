@@ -0,0 +1,214 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+)
+
+// ErrMissingFormatKey indicates that a format function (select, plural, or
+// ordinal) has no property for the chosen key, and there was no fallback.
+const ErrMissingFormatKey = virtualMachineError("format function key not found")
+
+// MissingKeyPolicy controls what happens when a select, plural, or ordinal
+// format function has no property for the chosen key.
+type MissingKeyPolicy int
+
+const (
+	// RejectMissingKeys causes rendering the line to fail with
+	// ErrMissingFormatKey. This is the default.
+	RejectMissingKeys MissingKeyPolicy = iota
+
+	// FallbackMissingKeys uses the "other" property instead, or if there is
+	// no "other" property, the StringTable's DefaultFormatKey property.
+	// Rendering fails only if none of these are present.
+	FallbackMissingKeys
+)
+
+func (p MissingKeyPolicy) String() string {
+	switch p {
+	case RejectMissingKeys:
+		return "reject"
+	case FallbackMissingKeys:
+		return "fallback"
+	default:
+		return fmt.Sprintf("(invalid MissingKeyPolicy %d)", p)
+	}
+}
+
+// formatKeyValue returns the value of the format function property for key,
+// applying the string table's MissingKeyPolicy if there isn't one.
+func (b *lineRenderer) formatKeyValue(f *parsedMarkupTag, key string) (*stringOrSubst, error) {
+	val, err := b.propValueForKey(f, key)
+	if err == nil {
+		return val, nil
+	}
+	err = fmt.Errorf("%w: %w", ErrMissingFormatKey, err)
+	if b.table == nil {
+		return nil, err
+	}
+	if b.table.MissingKeyFunc != nil {
+		b.table.MissingKeyFunc(b.lineID, f.Name, key)
+	}
+	if b.table.MissingKeys != FallbackMissingKeys {
+		return nil, err
+	}
+	for _, fb := range []string{"other", b.table.DefaultFormatKey} {
+		if fb == "" || fb == key {
+			continue
+		}
+		if val, err := b.propValueForKey(f, fb); err == nil {
+			return val, nil
+		}
+	}
+	return nil, err
+}
+
+// MissingFormatKey describes a plural or ordinal format function that lacks
+// a property for a plural category (zero, one, two, few, many, or other) that
+// the language uses.
+type MissingFormatKey struct {
+	LineID string
+	Func   string // "plural" or "ordinal"
+	Key    string
+}
+
+// LintFormatFuncs checks that every plural and ordinal format function in the
+// table has properties for all the plural categories (as defined by Unicode
+// CLDR) of the table's language. For example, Polish plurals need one, few,
+// many, and other. Format functions nested within the properties of other
+// tags are also checked. The result is sorted by line ID.
+//
+// golang.org/x/text doesn't list the plural categories of a language, so
+// they are found by matching about 3,000 sample numbers against the rules the
+// first time each language is checked (see pluralForms).
+func (t *StringTable) LintFormatFuncs() ([]MissingFormatKey, error) {
+	cardinal := pluralForms(plural.Cardinal, t.Language)
+	ordinal := pluralForms(plural.Ordinal, t.Language)
+	ids := make([]string, 0, len(t.Table))
+	for id := range t.Table {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var missing []MissingFormatKey
+	for _, id := range ids {
+		row := t.Table[id]
+		if row == nil {
+			continue
+		}
+		if err := row.parseIfNeeded(); err != nil {
+			return missing, fmt.Errorf("line %q: %w", id, err)
+		}
+		walkMarkupTags(row.parsedText, func(f *parsedMarkupTag) {
+			var forms []string
+			switch f.Name {
+			case "plural":
+				forms = cardinal
+			case "ordinal":
+				forms = ordinal
+			default:
+				return
+			}
+			for _, key := range forms {
+				if !slices.ContainsFunc(f.Props, func(p *parsedProp) bool { return p.Key == key }) {
+					missing = append(missing, MissingFormatKey{LineID: id, Func: f.Name, Key: key})
+				}
+			}
+		})
+	}
+	return missing, nil
+}
+
+// walkMarkupTags calls visit for each markup tag in p, including those within
+// quoted property values.
+func walkMarkupTags(p *parsedString, visit func(*parsedMarkupTag)) {
+	if p == nil {
+		return
+	}
+	for _, frag := range p.Fragments {
+		if frag == nil || frag.Markup == nil {
+			continue
+		}
+		visit(frag.Markup)
+		if frag.Markup.Value != nil {
+			walkMarkupTags(frag.Markup.Value.String, visit)
+		}
+		for _, prop := range frag.Markup.Props {
+			walkMarkupTags(prop.Value.String, visit)
+		}
+	}
+}
+
+type pluralFormsKey struct {
+	rules *plural.Rules
+	lang  language.Tag
+}
+
+// pluralFormsCache caches the results of pluralForms.
+var pluralFormsCache sync.Map // pluralFormsKey -> []string
+
+// pluralForms returns the keys of the plural categories that rules can choose
+// for the language, in CLDR order (zero, one, two, few, many, other).
+// golang.org/x/text doesn't list the categories, so they are found by trying
+// a range of integers and decimals (enough to reach every category in CLDR's
+// rules).
+func pluralForms(rules *plural.Rules, lang language.Tag) []string {
+	key := pluralFormsKey{rules, lang}
+	if forms, ok := pluralFormsCache.Load(key); ok {
+		return forms.([]string)
+	}
+	seen := make([]bool, len(formKeyTable))
+	match := func(i, v, f int) {
+		// t is f without trailing zeros, and w is the number of digits in t.
+		t, w := f, v
+		for w > 0 && t%10 == 0 {
+			t /= 10
+			w--
+		}
+		if form := rules.MatchPlural(lang, i, v, w, f, t); int(form) < len(seen) {
+			seen[form] = true
+		}
+	}
+	for i := 0; i <= 1000; i++ {
+		match(i, 0, 0)
+	}
+	for _, i := range []int{10000, 100000, 1000000, 10000000} {
+		match(i, 0, 0)
+	}
+	for i := 0; i <= 100; i++ {
+		for f := 0; f < 10; f++ {
+			match(i, 1, f)
+		}
+	}
+	for i := 0; i <= 10; i++ {
+		for f := 0; f < 100; f++ {
+			match(i, 2, f)
+		}
+	}
+	var forms []string
+	for _, form := range []plural.Form{plural.Zero, plural.One, plural.Two, plural.Few, plural.Many, plural.Other} {
+		if seen[form] {
+			forms = append(forms, formKeyTable[form])
+		}
+	}
+	pluralFormsCache.Store(key, forms)
+	return forms
+}
@@ -0,0 +1,135 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/text/language"
+)
+
+func TestMissingFormatKeys(t *testing.T) {
+	type report struct{ LineID, Func, Key string }
+	tests := []struct {
+		policy     MissingKeyPolicy
+		defaultKey string
+		input      string
+		subst      string
+		want       string
+		wantErr    error
+		wantReport []report
+	}{
+		{
+			policy: RejectMissingKeys,
+			input:  `[plural value={0} one="% jabłko" other="% jabłka"/]`,
+			subst:  "1",
+			want:   "1 jabłko",
+		},
+		{
+			policy:     RejectMissingKeys,
+			input:      `[plural value={0} one="% jabłko" other="% jabłka"/]`,
+			subst:      "2",
+			wantErr:    ErrMissingFormatKey,
+			wantReport: []report{{"line:1", "plural", "few"}},
+		},
+		{
+			policy:     FallbackMissingKeys,
+			input:      `[plural value={0} one="% jabłko" other="% jabłka"/]`,
+			subst:      "2",
+			want:       "2 jabłka",
+			wantReport: []report{{"line:1", "plural", "few"}},
+		},
+		{
+			policy:     FallbackMissingKeys,
+			defaultKey: "fallback",
+			input:      `[select value={0} m="he" f="she" fallback="they"/]`,
+			subst:      "nb",
+			want:       "they",
+			wantReport: []report{{"line:1", "select", "nb"}},
+		},
+		{
+			policy:     FallbackMissingKeys,
+			input:      `[select value={0} m="he" f="she"/]`,
+			subst:      "nb",
+			wantErr:    ErrMissingFormatKey,
+			wantReport: []report{{"line:1", "select", "nb"}},
+		},
+	}
+	for _, test := range tests {
+		var got []report
+		st := &StringTable{
+			Language:         language.Polish,
+			Table:            map[string]*StringTableRow{"line:1": {ID: "line:1", Text: test.input}},
+			MissingKeys:      test.policy,
+			DefaultFormatKey: test.defaultKey,
+			MissingKeyFunc: func(lineID, funcName, key string) {
+				got = append(got, report{lineID, funcName, key})
+			},
+		}
+		as, err := st.Render(Line{ID: "line:1", Substitutions: []string{test.subst}})
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("%v: Render(%q) error = %v, want %v", test.policy, test.input, err, test.wantErr)
+		}
+		if err == nil && as.String() != test.want {
+			t.Errorf("%v: Render(%q) = %q, want %q", test.policy, test.input, as.String(), test.want)
+		}
+		if diff := cmp.Diff(got, test.wantReport); diff != "" {
+			t.Errorf("%v: Render(%q) reports diff (-got +want):\n%s", test.policy, test.input, diff)
+		}
+	}
+}
+
+func TestMissingValueIsNotMissingKey(t *testing.T) {
+	st := &StringTable{
+		Language:    language.Polish,
+		Table:       map[string]*StringTableRow{"line:1": {ID: "line:1", Text: `[plural one="% jabłko" other="% jabłka"/]`}},
+		MissingKeys: FallbackMissingKeys,
+		MissingKeyFunc: func(lineID, funcName, key string) {
+			t.Errorf("MissingKeyFunc(%q, %q, %q) called, want no calls", lineID, funcName, key)
+		},
+	}
+	_, err := st.Render(Line{ID: "line:1", Substitutions: []string{"2"}})
+	if err == nil || errors.Is(err, ErrMissingFormatKey) {
+		t.Errorf("Render() error = %v, want an error other than %v", err, ErrMissingFormatKey)
+	}
+}
+
+func TestLintFormatFuncs(t *testing.T) {
+	st := &StringTable{
+		Language: language.Polish,
+		Table: map[string]*StringTableRow{
+			"line:a": {ID: "line:a", Text: `[plural value={0} one="jabłko" few="jabłka" many="jabłek" other="jabłka"/]`},
+			"line:b": {ID: "line:b", Text: `Masz [plural value={0} one="jabłko" other="jabłka"/].`},
+			"line:c": {ID: "line:c", Text: `[select value={0} m="[plural value={1} one="raz"/]" f="x"/] [ordinal value={0} other="."/]`},
+			"line:d": {ID: "line:d", Text: "No format functions."},
+		},
+	}
+	got, err := st.LintFormatFuncs()
+	if err != nil {
+		t.Fatalf("LintFormatFuncs() error = %v", err)
+	}
+	want := []MissingFormatKey{
+		{LineID: "line:b", Func: "plural", Key: "few"},
+		{LineID: "line:b", Func: "plural", Key: "many"},
+		{LineID: "line:c", Func: "plural", Key: "few"},
+		{LineID: "line:c", Func: "plural", Key: "many"},
+		{LineID: "line:c", Func: "plural", Key: "other"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("LintFormatFuncs() diff (-got +want):\n%s", diff)
+	}
+}
@@ -17,8 +17,8 @@ package yarn
 import (
 	"fmt"
 	"math"
-	"math/big"
 	"math/rand"
+	"strconv"
 )
 
 // FuncMap maps function names to implementations.  It is similar to the
@@ -27,22 +27,20 @@ import (
 // Each function must return either 0, 1, or 2 values, and if 2 are returned,
 // the latter must be type `error`.
 //
+// A function may have a leading context.Context or *CallContext parameter,
+// which is provided by the VM rather than the program (see CallContext).
+//
 // If the arguments being passed by the program are not assignable to an
 // argument, and the argument has type bool, int, float32, float64, or string,
 // then a conversion is attempted by the VM. For example, if the stack has the
 // values ("3", true, 2) on top, CALL_FUNC with "Number.Add" (see below) would
 // cause Number.Add's implementation to be called with (3.0, 1.0) (the 2 is the
 // argument count).
+//
+// See also Library, which supports the same kinds of functions, but converts
+// them ahead of time.
 type FuncMap map[string]interface{}
 
-// merge merges fm into m and returns m.
-func (m FuncMap) merge(fm FuncMap) FuncMap {
-	for n, f := range fm {
-		m[n] = f
-	}
-	return m
-}
-
 // defaultFuncMap returns a FuncMap with the standard Yarn Spinner operators.
 func defaultFuncMap() FuncMap {
 	return FuncMap{
@@ -96,9 +94,7 @@ func defaultFuncMap() FuncMap {
 		"dice":         func(x int) float32 { return float32(rand.Intn(x) + 1) },
 		"round":        func(x float32) float32 { return float32(math.Round(float64(x))) },
 		"round_places": func(n float32, places uint) float32 {
-			f := new(big.Float).SetMode(big.ToNearestEven).SetPrec(places).SetFloat64(float64(n))
-			result, _ := f.Float32()
-			return result
+			return float32(roundPlaces(float64(n), places, 32))
 		},
 		"floor":   func(n float32) float32 { return float32(math.Floor(float64(n))) },
 		"ceil":    func(n float32) float32 { return float32(math.Ceil(float64(n))) },
@@ -108,6 +104,49 @@ func defaultFuncMap() FuncMap {
 	}
 }
 
+// defaultFuncMap64 returns float64 versions of the functions in defaultFuncMap
+// that take or return numbers, for NumericFloat64 mode. (The others, such as
+// Add and EqualTo, already work with float64 values.)
+func defaultFuncMap64() FuncMap {
+	return FuncMap{
+		"GreaterThan":          func(x, y float64) bool { return x > y },
+		"GreaterThanOrEqualTo": func(x, y float64) bool { return x >= y },
+		"LessThan":             func(x, y float64) bool { return x < y },
+		"LessThanOrEqualTo":    func(x, y float64) bool { return x <= y },
+		"UnaryMinus":           func(x float64) float64 { return -x },
+		"Minus":                func(x, y float64) float64 { return x - y },
+		"Multiply":             func(x, y float64) float64 { return x * y },
+		"Divide":               func(x, y float64) float64 { return x / y },
+		"Modulo":               func(x, y int) float64 { return float64(x % y) },
+
+		"Number.EqualTo":              func(x, y float64) bool { return x == y },
+		"Number.NotEqualTo":           func(x, y float64) bool { return x != y },
+		"Number.Add":                  func(x, y float64) float64 { return x + y },
+		"Number.Minus":                func(x, y float64) float64 { return x - y },
+		"Number.Multiply":             func(x, y float64) float64 { return x * y },
+		"Number.Divide":               func(x, y float64) float64 { return x / y },
+		"Number.Modulo":               func(x, y int) float64 { return float64(x % y) },
+		"Number.UnaryMinus":           func(x float64) float64 { return -x },
+		"Number.GreaterThan":          func(x, y float64) bool { return x > y },
+		"Number.GreaterThanOrEqualTo": func(x, y float64) bool { return x >= y },
+		"Number.LessThan":             func(x, y float64) bool { return x < y },
+		"Number.LessThanOrEqualTo":    func(x, y float64) bool { return x <= y },
+
+		"random":       func() float64 { return rand.Float64() },
+		"random_range": func(x, y int) float64 { return float64(rand.Intn(y-x) + x) },
+		"dice":         func(x int) float64 { return float64(rand.Intn(x) + 1) },
+		"round":        math.Round,
+		"round_places": func(n float64, places uint) float64 {
+			return roundPlaces(n, places, 64)
+		},
+		"floor":   math.Floor,
+		"ceil":    math.Ceil,
+		"inc":     func(n float64) float64 { return math.Trunc(n) + 1 },
+		"dec":     func(n float64) float64 { return math.Ceil(n) - 1 },
+		"decimal": func(n float64) float64 { _, f := math.Modf(n); return f },
+	}
+}
+
 func funcAdd(x, y interface{}) (interface{}, error) {
 	if x == nil {
 		return y, nil
@@ -125,6 +164,11 @@ func funcAdd(x, y interface{}) (interface{}, error) {
 	// numeric, probably
 	switch xt := x.(type) {
 	case bool:
+		if yt, ok := y.(float64); ok {
+			// keep float64 precision (see NumericFloat64)
+			xtt, _ := ConvertToFloat64(xt)
+			return xtt + yt, nil
+		}
 		// upconvert both to numbers
 		xtt, err := ConvertToFloat32(x)
 		if err != nil {
@@ -156,3 +200,14 @@ func funcAdd(x, y interface{}) (interface{}, error) {
 	}
 	return false, fmt.Errorf("unsupported type [%T ∉ {nil,bool,float32,float64,int,string}]", x)
 }
+
+// roundPlaces rounds n to the given number of decimal places (at most 15, as
+// in C#), with halfway values rounded to even, like C# Math.Round. bitSize is
+// the precision (32 or 64) of the result.
+func roundPlaces(n float64, places uint, bitSize int) float64 {
+	r, err := strconv.ParseFloat(strconv.FormatFloat(n, 'f', int(min(places, 15)), 64), bitSize)
+	if err != nil {
+		return n
+	}
+	return r
+}
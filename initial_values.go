@@ -0,0 +1,111 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"sort"
+	"strings"
+
+	yarnpb "drjosh.dev/yarn/bytecode"
+)
+
+// DeclaredVariable describes a variable declared in a program (with
+// <<declare>>), from the program's InitialValues.
+type DeclaredVariable struct {
+	Name    string
+	Default Value
+}
+
+// Kind returns the kind of value the variable holds.
+func (d DeclaredVariable) Kind() ValueKind { return d.Default.Kind() }
+
+// DeclaredVariables returns the variables declared in the program, sorted by
+// name.
+func DeclaredVariables(prog *yarnpb.Program) []DeclaredVariable {
+	vars := make([]DeclaredVariable, 0, len(prog.InitialValues))
+	for name, op := range prog.InitialValues {
+		vars = append(vars, DeclaredVariable{
+			Name:    name,
+			Default: valueFromOperand(op),
+		})
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+	return vars
+}
+
+// ApplyDefaults stores the default value of each declared variable that is
+// not already in vars. Afterwards, vars contains every declared variable (for
+// example, for a save file, or to list in a UI). It returns the names of the
+// variables that were set.
+func ApplyDefaults(prog *yarnpb.Program, vars VariableStorage) []string {
+	var set []string
+	for _, d := range DeclaredVariables(prog) {
+		if _, found := vars.GetValue(d.Name); found {
+			continue
+		}
+		storeValue(vars, d.Name, d.Default)
+		set = append(set, d.Name)
+	}
+	return set
+}
+
+// ResetVariables stores the default value of each declared variable whose
+// name begins with prefix, overwriting any existing value. To reset all
+// declared variables, pass an empty prefix. It returns the names of the
+// variables that were reset.
+func ResetVariables(prog *yarnpb.Program, vars VariableStorage, prefix string) []string {
+	var reset []string
+	for _, d := range DeclaredVariables(prog) {
+		if !strings.HasPrefix(d.Name, prefix) {
+			continue
+		}
+		storeValue(vars, d.Name, d.Default)
+		reset = append(reset, d.Name)
+	}
+	return reset
+}
+
+// StaleVariables returns the names (from names, which would usually be the
+// keys of a storage's Contents) that are neither declared in the program, nor
+// visit counts for nodes in the program. These are likely left over from an
+// earlier version of the program. The result is sorted.
+//
+// Note that older programs (and variables used without <<declare>>) have no
+// declarations, so all their variables would be reported.
+func StaleVariables(prog *yarnpb.Program, names []string) []string {
+	var stale []string
+	for _, name := range names {
+		if _, declared := prog.InitialValues[name]; declared {
+			continue
+		}
+		if node, ok := strings.CutPrefix(name, VisitCountVariablePrefix); ok {
+			if _, exists := prog.Nodes[node]; exists {
+				continue
+			}
+		}
+		stale = append(stale, name)
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// storeValue stores a Value in vars, using SetTypedValue if possible.
+func storeValue(vars VariableStorage, name string, v Value) {
+	if tv, ok := vars.(TypedVariableStorage); ok {
+		tv.SetTypedValue(name, v)
+		return
+	}
+	vars.SetValue(name, v.Interface())
+}
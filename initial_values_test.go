@@ -0,0 +1,99 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	yarnpb "drjosh.dev/yarn/bytecode"
+	"github.com/google/go-cmp/cmp"
+)
+
+// declProgram returns a program with a Start node and some declared
+// variables.
+func declProgram() *yarnpb.Program {
+	prog := loopProgram(0)
+	prog.InitialValues = map[string]*yarnpb.Operand{
+		"$gold":         NumberValue(10).Operand(),
+		"$met_mae":      BoolValue(false).Operand(),
+		"$quest_start":  BoolValue(false).Operand(),
+		"$quest_target": StringValue("the well").Operand(),
+	}
+	return prog
+}
+
+func TestDeclaredVariables(t *testing.T) {
+	got := DeclaredVariables(declProgram())
+	want := []DeclaredVariable{
+		{"$gold", NumberValue(10)},
+		{"$met_mae", BoolValue(false)},
+		{"$quest_start", BoolValue(false)},
+		{"$quest_target", StringValue("the well")},
+	}
+	if diff := cmp.Diff(got, want, cmp.Comparer(Value.Equal)); diff != "" {
+		t.Errorf("DeclaredVariables diff (-got +want):\n%s", diff)
+	}
+	if got, want := got[0].Kind(), NumberKind; got != want {
+		t.Errorf("got[0].Kind() = %v, want %v", got, want)
+	}
+}
+
+func TestApplyDefaultsAndReset(t *testing.T) {
+	prog := declProgram()
+	vars := NewMapVariableStorageFromMap(map[string]any{
+		"$gold":        float32(3),
+		"$quest_start": true,
+	})
+
+	gotSet := ApplyDefaults(prog, vars)
+	if diff := cmp.Diff(gotSet, []string{"$met_mae", "$quest_target"}); diff != "" {
+		t.Errorf("ApplyDefaults diff (-got +want):\n%s", diff)
+	}
+	want := map[string]any{
+		"$gold":         float32(3),
+		"$met_mae":      false,
+		"$quest_start":  true,
+		"$quest_target": "the well",
+	}
+	if diff := cmp.Diff(vars.Contents(), want); diff != "" {
+		t.Errorf("contents after ApplyDefaults diff (-got +want):\n%s", diff)
+	}
+
+	vars.SetValue("$quest_target", "the castle")
+	gotReset := ResetVariables(prog, vars, "$quest_")
+	if diff := cmp.Diff(gotReset, []string{"$quest_start", "$quest_target"}); diff != "" {
+		t.Errorf("ResetVariables diff (-got +want):\n%s", diff)
+	}
+	want["$quest_start"] = false
+	if diff := cmp.Diff(vars.Contents(), want); diff != "" {
+		t.Errorf("contents after ResetVariables diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestStaleVariables(t *testing.T) {
+	vars := map[string]any{
+		"$gold":                            float32(3),
+		"$old_name":                        "x",
+		VisitCountVariablePrefix + "Start": float32(1),
+		VisitCountVariablePrefix + "Gone":  float32(1),
+	}
+	got := StaleVariables(declProgram(), slices.Collect(maps.Keys(vars)))
+	want := []string{"$Yarn.Internal.Visiting.Gone", "$old_name"}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("StaleVariables diff (-got +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrCannotDelete is returned by LayeredVariableStorage.Commit when the layer
+// contains deletions, but the base storage has no Delete method.
+const ErrCannotDelete = virtualMachineError("base storage cannot delete")
+
+var (
+	_ TypedVariableStorage    = &LayeredVariableStorage{}
+	_ FallibleVariableStorage = &LayeredVariableStorage{}
+)
+
+// deletableVariableStorage is implemented by the VariableStorages in this
+// package (and hopefully others).
+type deletableVariableStorage interface {
+	Delete(names ...string)
+}
+
+// layerEntry is either a value written to the layer, or a deletion.
+type layerEntry struct {
+	value   any // a Value, if the value was convertible
+	deleted bool
+}
+
+// LayeredVariableStorage overlays a writable layer on a base storage, which
+// is only read from until Commit is called. Writes and deletions are kept in
+// the layer, and reads fall through to the base for variables not in the
+// layer. Commit applies the changes to the base, and Rollback discards them.
+//
+// Layers can be nested by using one LayeredVariableStorage as the base of
+// another. Committing the inner layer applies its changes to the outer layer
+// only.
+type LayeredVariableStorage struct {
+	mu    sync.RWMutex
+	base  VariableStorage
+	layer map[string]layerEntry
+}
+
+// NewLayeredVariableStorage returns a new LayeredVariableStorage with an
+// empty layer over base.
+func NewLayeredVariableStorage(base VariableStorage) *LayeredVariableStorage {
+	return &LayeredVariableStorage{
+		base:  base,
+		layer: make(map[string]layerEntry),
+	}
+}
+
+// Base returns the base storage.
+func (l *LayeredVariableStorage) Base() VariableStorage { return l.base }
+
+// GetTypedValue fetches a value from the layer, or from the base if the layer
+// doesn't have it, returning (null, false) if not present or not convertible
+// to Value.
+func (l *LayeredVariableStorage) GetTypedValue(name string) (value Value, found bool) {
+	l.mu.RLock()
+	e, inLayer := l.layer[name]
+	l.mu.RUnlock()
+	if !inLayer {
+		if tv, ok := l.base.(TypedVariableStorage); ok {
+			return tv.GetTypedValue(name)
+		}
+		x, found := l.base.GetValue(name)
+		if !found {
+			return Value{}, false
+		}
+		e.value = x
+	}
+	if e.deleted {
+		return Value{}, false
+	}
+	return valueOrOpaque(e.value), true
+}
+
+// SetTypedValue sets a value in the layer.
+func (l *LayeredVariableStorage) SetTypedValue(name string, value Value) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.layer[name] = layerEntry{value: value}
+}
+
+// GetValue fetches a value from the layer, or from the base if the layer
+// doesn't have it, returning (nil, false) if not present.
+func (l *LayeredVariableStorage) GetValue(name string) (value any, found bool) {
+	l.mu.RLock()
+	e, inLayer := l.layer[name]
+	l.mu.RUnlock()
+	if !inLayer {
+		return l.base.GetValue(name)
+	}
+	if e.deleted {
+		return nil, false
+	}
+	if v, ok := e.value.(Value); ok {
+		return v.Interface(), true
+	}
+	return e.value, true
+}
+
+// SetValue sets a value in the layer.
+func (l *LayeredVariableStorage) SetValue(name string, value any) {
+	if v, err := ValueOf(value); err == nil {
+		value = v
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.layer[name] = layerEntry{value: value}
+}
+
+// Delete records deletions in the layer. The values are hidden from
+// subsequent reads, and deleted from the base by Commit.
+func (l *LayeredVariableStorage) Delete(names ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, name := range names {
+		l.layer[name] = layerEntry{deleted: true}
+	}
+}
+
+// Dirty reports whether the layer contains any uncommitted changes.
+func (l *LayeredVariableStorage) Dirty() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.layer) > 0
+}
+
+// Commit applies the changes in the layer to the base storage (in order of
+// variable name), and then empties the layer. If the layer contains
+// deletions, the base storage must have a Delete method, otherwise Commit
+// returns ErrCannotDelete without changing anything. If the base storage
+// implements FallibleVariableStorage, any error from the base is returned.
+func (l *LayeredVariableStorage) Commit() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	names := make([]string, 0, len(l.layer))
+	hasDeletes := false
+	for name, e := range l.layer {
+		names = append(names, name)
+		hasDeletes = hasDeletes || e.deleted
+	}
+	sort.Strings(names)
+
+	del, canDelete := l.base.(deletableVariableStorage)
+	if hasDeletes && !canDelete {
+		return fmt.Errorf("%w: %T", ErrCannotDelete, l.base)
+	}
+	tv, typed := l.base.(TypedVariableStorage)
+	for _, name := range names {
+		e := l.layer[name]
+		switch v, isValue := e.value.(Value); {
+		case e.deleted:
+			del.Delete(name)
+		case isValue && typed:
+			tv.SetTypedValue(name, v)
+		case isValue:
+			l.base.SetValue(name, v.Interface())
+		default:
+			l.base.SetValue(name, e.value)
+		}
+	}
+	l.layer = make(map[string]layerEntry)
+
+	if fv, ok := l.base.(FallibleVariableStorage); ok {
+		return fv.Err()
+	}
+	return nil
+}
+
+// Rollback discards the changes in the layer.
+func (l *LayeredVariableStorage) Rollback() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.layer = make(map[string]layerEntry)
+}
+
+// Err returns the error from the base storage, if it implements
+// FallibleVariableStorage, otherwise nil.
+func (l *LayeredVariableStorage) Err() error {
+	if fv, ok := l.base.(FallibleVariableStorage); ok {
+		return fv.Err()
+	}
+	return nil
+}
+
+// IsReadOnly reports whether the base storage has a read-only variable called
+// name (see ComputedVariableStorage).
+func (l *LayeredVariableStorage) IsReadOnly(name string) bool {
+	ro, ok := l.base.(readOnlyChecker)
+	return ok && ro.IsReadOnly(name)
+}
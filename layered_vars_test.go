@@ -0,0 +1,231 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	yarnpb "drjosh.dev/yarn/bytecode"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLayeredVariableStorage(t *testing.T) {
+	base := NewMapVariableStorageFromMap(map[string]any{
+		"$a": "base a",
+		"$b": "base b",
+	})
+	l := NewLayeredVariableStorage(base)
+	l.SetValue("$a", "layer a")
+	l.SetTypedValue("$c", NumberValue(3))
+	l.Delete("$b")
+
+	if got, ok := l.GetValue("$a"); !ok || got != "layer a" {
+		t.Errorf("l.GetValue($a) = %v, %t, want layer a, true", got, ok)
+	}
+	if got, ok := l.GetValue("$b"); ok {
+		t.Errorf("l.GetValue($b) = %v, %t, want nil, false", got, ok)
+	}
+	if got, ok := l.GetTypedValue("$c"); !ok || !got.Equal(NumberValue(3)) {
+		t.Errorf("l.GetTypedValue($c) = %v, %t, want 3, true", got, ok)
+	}
+
+	// The base is unchanged until Commit.
+	want := map[string]any{"$a": "base a", "$b": "base b"}
+	if diff := cmp.Diff(base.Contents(), want); diff != "" {
+		t.Errorf("base contents before Commit diff (-got +want):\n%s", diff)
+	}
+	if !l.Dirty() {
+		t.Error("l.Dirty() = false, want true")
+	}
+	if err := l.Commit(); err != nil {
+		t.Fatalf("l.Commit() = %v", err)
+	}
+	want = map[string]any{"$a": "layer a", "$c": float32(3)}
+	if diff := cmp.Diff(base.Contents(), want); diff != "" {
+		t.Errorf("base contents after Commit diff (-got +want):\n%s", diff)
+	}
+
+	// Rollback discards changes.
+	l.SetValue("$a", "discarded")
+	l.Rollback()
+	if got, ok := l.GetValue("$a"); !ok || got != "layer a" {
+		t.Errorf("after Rollback, l.GetValue($a) = %v, %t, want layer a, true", got, ok)
+	}
+	if l.Dirty() {
+		t.Error("after Rollback, l.Dirty() = true, want false")
+	}
+}
+
+func TestLayeredVariableStorageNested(t *testing.T) {
+	base := NewTypedMapVariableStorage()
+	outer := NewLayeredVariableStorage(base)
+	inner := NewLayeredVariableStorage(outer)
+	inner.SetValue("$x", true)
+	if err := inner.Commit(); err != nil {
+		t.Fatalf("inner.Commit() = %v", err)
+	}
+	if got, ok := outer.GetValue("$x"); !ok || got != true {
+		t.Errorf("outer.GetValue($x) = %v, %t, want true, true", got, ok)
+	}
+	if _, ok := base.GetValue("$x"); ok {
+		t.Error("base.GetValue($x) ok = true before outer.Commit, want false")
+	}
+	outer.Rollback()
+	if _, ok := inner.GetValue("$x"); ok {
+		t.Error("inner.GetValue($x) ok = true after outer.Rollback, want false")
+	}
+}
+
+// noDeleteStorage is a VariableStorage without a Delete method.
+type noDeleteStorage struct{ VariableStorage }
+
+func TestLayeredVariableStorageCannotDelete(t *testing.T) {
+	base := noDeleteStorage{NewMapVariableStorage()}
+	l := NewLayeredVariableStorage(base)
+	l.SetValue("$a", 1)
+	l.Delete("$b")
+	if err := l.Commit(); !errors.Is(err, ErrCannotDelete) {
+		t.Errorf("l.Commit() = %v, want %v", err, ErrCannotDelete)
+	}
+	if _, ok := base.GetValue("$a"); ok {
+		t.Error("base.GetValue($a) ok = true after failed Commit, want false")
+	}
+}
+
+func TestTransactionalVMCommits(t *testing.T) {
+	base := NewMapVariableStorage()
+	vm := &VirtualMachine{
+		Program:       loopProgram(3),
+		Handler:       FakeDialogueHandler{},
+		Vars:          base,
+		Transactional: true,
+	}
+	if err := vm.Run("Start"); err != nil {
+		t.Fatalf("vm.Run(Start) = %v", err)
+	}
+	if got, ok := base.GetValue("$x"); !ok || got != float32(2) {
+		t.Errorf("base.GetValue($x) = %v, %t, want 2, true", got, ok)
+	}
+	if vm.Vars != base {
+		t.Errorf("vm.Vars = %v, want base storage", vm.Vars)
+	}
+}
+
+// failingNodeCompleteHandler returns errDummy from NodeComplete.
+type failingNodeCompleteHandler struct {
+	FakeDialogueHandler
+}
+
+func (failingNodeCompleteHandler) NodeComplete(string) error { return errDummy }
+
+func TestTransactionalVMRollsBackOnError(t *testing.T) {
+	base := NewMapVariableStorage()
+	vm := &VirtualMachine{
+		Program:       loopProgram(3),
+		Handler:       failingNodeCompleteHandler{},
+		Vars:          base,
+		Transactional: true,
+	}
+	if err := vm.Run("Start"); !errors.Is(err, errDummy) {
+		t.Errorf("vm.Run(Start) = %v, want %v", err, errDummy)
+	}
+	if got, ok := base.GetValue("$x"); ok {
+		t.Errorf("base.GetValue($x) = %v, %t, want nil, false", got, ok)
+	}
+	if vm.Vars != base {
+		t.Errorf("vm.Vars = %v, want base storage", vm.Vars)
+	}
+}
+
+// completeRecorder records whether DialogueComplete was called.
+type completeRecorder struct {
+	FakeDialogueHandler
+	complete bool
+}
+
+func (c *completeRecorder) DialogueComplete() error {
+	c.complete = true
+	return nil
+}
+
+func TestTransactionalVMNoOptions(t *testing.T) {
+	// Store $x, then show options without adding any.
+	prog := loopProgram(1)
+	node := prog.Nodes["Start"]
+	node.Instructions = append(node.Instructions[:len(node.Instructions)-1],
+		&yarnpb.Instruction{Opcode: yarnpb.Instruction_SHOW_OPTIONS},
+		&yarnpb.Instruction{Opcode: yarnpb.Instruction_STOP},
+	)
+	for _, transactional := range []bool{false, true} {
+		base := NewMapVariableStorage()
+		handler := &completeRecorder{}
+		vm := &VirtualMachine{
+			Program:       prog,
+			Handler:       handler,
+			Vars:          base,
+			Transactional: transactional,
+		}
+		if err := vm.Run("Start"); !errors.Is(err, ErrNoOptions) {
+			t.Errorf("Transactional=%t: vm.Run(Start) = %v, want %v", transactional, err, ErrNoOptions)
+		}
+		if got, want := handler.complete, !transactional; got != want {
+			t.Errorf("Transactional=%t: DialogueComplete called = %t, want %t", transactional, got, want)
+		}
+		if _, ok := base.GetValue("$x"); ok != !transactional {
+			t.Errorf("Transactional=%t: base.GetValue($x) ok = %t, want %t", transactional, ok, !transactional)
+		}
+	}
+}
+
+func TestTransactionalVMRollsBackOnAbort(t *testing.T) {
+	// Store $x, then wait.
+	prog := loopProgram(1)
+	node := prog.Nodes["Start"]
+	node.Instructions = append(node.Instructions[:len(node.Instructions)-1],
+		&yarnpb.Instruction{
+			Opcode:   yarnpb.Instruction_RUN_COMMAND,
+			Operands: []*yarnpb.Operand{{Value: &yarnpb.Operand_StringValue{StringValue: "wait 10"}}},
+		},
+		&yarnpb.Instruction{Opcode: yarnpb.Instruction_STOP},
+	)
+
+	clock := NewFakeClock(time.Unix(0, 0))
+	ah := &FakeAsyncDialogueHandler{}
+	aa := NewAsyncAdapter(ah)
+	ah.AsyncAdapter = aa
+	base := NewMapVariableStorage()
+	vm := &VirtualMachine{
+		Program:       prog,
+		Handler:       aa,
+		Vars:          base,
+		Clock:         clock,
+		Transactional: true,
+	}
+	errCh := make(chan error)
+	go func() { errCh <- vm.Run("Start") }()
+
+	clock.BlockUntil(1)
+	if err := aa.Abort(errDummy); err != nil {
+		t.Errorf("aa.Abort(errDummy) = %v", err)
+	}
+	if err := <-errCh; !errors.Is(err, errDummy) {
+		t.Errorf("vm.Run(Start) = %v, want %v", err, errDummy)
+	}
+	if got, ok := base.GetValue("$x"); ok {
+		t.Errorf("base.GetValue($x) = %v, %t, want nil, false", got, ok)
+	}
+}
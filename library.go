@@ -0,0 +1,734 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// YarnType is the name of a Yarn Spinner type, as used in function
+// declarations.
+type YarnType string
+
+// The Yarn Spinner types that functions can accept and return.
+const (
+	YarnTypeAny    YarnType = "Any"
+	YarnTypeBool   YarnType = "Bool"
+	YarnTypeNumber YarnType = "Number"
+	YarnTypeString YarnType = "String"
+)
+
+// accepts reports whether a value of kind k can be passed to a parameter of
+// type t without conversion.
+func (t YarnType) accepts(k ValueKind) bool {
+	switch t {
+	case YarnTypeBool:
+		return k == BoolKind
+	case YarnTypeNumber:
+		return k == NumberKind
+	case YarnTypeString:
+		return k == StringKind
+	}
+	return true
+}
+
+// FunctionDeclaration describes the Yarn Spinner signature of a function in a
+// Library, for use by tooling (such as editors and compilers). It can be
+// encoded as JSON.
+type FunctionDeclaration struct {
+	Name       string     `json:"name"`
+	Parameters []YarnType `json:"parameters"`
+
+	// Variadic is true if the last parameter may be repeated any number of
+	// times (including zero).
+	Variadic bool `json:"variadic,omitempty"`
+
+	// Returns is the type of the result, or empty if the function does not
+	// return a value.
+	Returns YarnType `json:"returns,omitempty"`
+}
+
+// FuncArg is the set of Go types that can be used as parameters and results
+// of functions registered with the generic helpers (Register1, etc). Numbers
+// can be float32, float64, or int. Use Value to accept or return any type.
+type FuncArg interface {
+	bool | float32 | float64 | int | string | Value
+}
+
+// function is a function in a Library, with a precomputed adapter.
+type function struct {
+	decl FunctionDeclaration
+
+	// call calls the function. vm is the calling VM (or nil), and args has
+	// exactly as many values as the program passed. If the function doesn't
+	// return a value, ok is false.
+	call func(vm *VirtualMachine, args []Value) (result Value, ok bool, err error)
+}
+
+// CallContext is passed to functions that have a leading *CallContext
+// parameter. It gives functions access to the VM calling them, so that they
+// need not rely on global state (which breaks when there are several dialogue
+// sessions at once). For example:
+//
+//	func hasItem(cc *yarn.CallContext, item string) bool {
+//		inv := cc.Session["inventory"].(*Inventory)
+//		return inv.Has(item)
+//	}
+//
+// Functions that only need a context can have a leading context.Context
+// parameter instead. Either way, the parameter is not counted among the
+// arguments passed by the program.
+type CallContext struct {
+	// Context is done when the VM is stopped: either the context passed to
+	// RunContext was cancelled, or the handler was aborted (see
+	// AsyncAdapter.Abort). It also carries the values of the context passed
+	// to RunContext.
+	context.Context
+
+	// VM is the calling virtual machine. It is nil if the function was called
+	// from outside a VM.
+	VM *VirtualMachine
+
+	// Node is the name of the current node.
+	Node string
+
+	// Vars is the VM's variable storage.
+	Vars VariableStorage
+
+	// Session is the VM's Session.
+	Session map[string]any
+}
+
+// callContext returns a CallContext for the VM. done must be called when the
+// function returns.
+func (vm *VirtualMachine) callContext() (cc *CallContext, done func()) {
+	if vm == nil {
+		return &CallContext{Context: context.Background()}, func() {}
+	}
+	ctx, done := vm.context()
+	cc = &CallContext{
+		Context: ctx,
+		VM:      vm,
+		Vars:    vm.Vars,
+		Session: vm.Session,
+	}
+	if vm.state.node != nil {
+		cc.Node = vm.state.node.Name
+	}
+	return cc, done
+}
+
+// checkArgc checks that argc arguments is acceptable.
+func (f *function) checkArgc(argc int) error {
+	want := len(f.decl.Parameters)
+	switch {
+	case f.decl.Variadic && argc < want-1:
+		// The last (variadic) arg is free to be empty. But we don't even have
+		// that many...
+		return fmt.Errorf("%w: insufficient args provided by program [got %d < want %d]", ErrFunctionArgMismatch, argc, want-1)
+	case !f.decl.Variadic && argc != want:
+		// Gotta match exactly.
+		return fmt.Errorf("%w: wrong number of args provided by program [got %d, want %d]", ErrFunctionArgMismatch, argc, want)
+	}
+	return nil
+}
+
+// Library is a collection of functions that can be called from Yarn
+// Spinner programs. Unlike FuncMap, each function's argument conversions are
+// worked out once when it is registered, rather than on every call, and
+// functions registered with the generic helpers (Register0, Register1, ...)
+// are called without reflection.
+//
+// Libraries should be populated before use. Once populated, a Library can be
+// used by many VirtualMachines concurrently.
+type Library struct {
+	funcs  map[string]*function
+	prefix string
+}
+
+// NewLibrary returns a new empty Library.
+func NewLibrary() *Library {
+	return &Library{funcs: make(map[string]*function)}
+}
+
+// LibraryFromFuncMap returns a new Library containing the functions in fm.
+// It returns an error if any function in fm is unsupported (see Register).
+func LibraryFromFuncMap(fm FuncMap) (*Library, error) {
+	l := NewLibrary()
+	for name, f := range fm {
+		if err := l.Register(name, f); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+var defaultLibrary = sync.OnceValue(func() *Library {
+	l, err := LibraryFromFuncMap(defaultFuncMap())
+	if err != nil {
+		panic(fmt.Sprintf("default FuncMap is invalid: %v", err))
+	}
+	return l
+})
+
+// defaultLibrary64 overrides some functions in defaultLibrary in
+// NumericFloat64 mode.
+var defaultLibrary64 = sync.OnceValue(func() *Library {
+	l, err := LibraryFromFuncMap(defaultFuncMap64())
+	if err != nil {
+		panic(fmt.Sprintf("default FuncMap (float64) is invalid: %v", err))
+	}
+	return l
+})
+
+// DefaultLibrary returns a new Library containing the standard Yarn Spinner
+// operators and built-in functions (except visited and visited_count, which
+// are provided by each VirtualMachine). The VM always provides these, so
+// there is no need to add them to VirtualMachine.Library; DefaultLibrary is
+// mainly useful for exporting declarations.
+func DefaultLibrary() *Library {
+	l := NewLibrary()
+	l.Merge(defaultLibrary())
+	return l
+}
+
+// Namespace returns a view of the library where the names of registered
+// functions are prefixed with name and a dot. For example, registering
+// "Add" in the "Number" namespace adds "Number.Add" to the library.
+func (l *Library) Namespace(name string) *Library {
+	if l.funcs == nil {
+		l.funcs = make(map[string]*function)
+	}
+	return &Library{funcs: l.funcs, prefix: l.prefix + name + "."}
+}
+
+// add adds a function to the library, replacing any existing function with
+// the same name.
+func (l *Library) add(name string, f *function) {
+	if l.funcs == nil {
+		l.funcs = make(map[string]*function)
+	}
+	f.decl.Name = l.prefix + name
+	l.funcs[f.decl.Name] = f
+}
+
+// lookup returns the function with a given (full) name, or nil.
+func (l *Library) lookup(name string) *function {
+	if l == nil {
+		return nil
+	}
+	return l.funcs[name]
+}
+
+// Register adds a function of any supported signature to the library, in
+// the same way as FuncMap:
+//
+//   - The function may have a leading context.Context or *CallContext
+//     parameter, which is supplied by the VM (see CallContext).
+//   - The function must return 0, 1, or 2 values, and if 2 are returned, the
+//     latter must be type error.
+//   - When called, arguments of type bool, string, or any integer or
+//     floating-point type are converted from the values passed by the
+//     program. Value arguments receive the value as-is. Arguments of other
+//     types must be assignable from the value (as returned by
+//     Value.Interface). Null values are passed as the zero value for the
+//     argument type.
+//
+// Common signatures (such as func(float32, float32) bool) are called without
+// reflection. For other signatures, consider the generic helpers (Register0,
+// Register1, etc), which never use reflection.
+func (l *Library) Register(name string, f any) error {
+	fn, err := newFunction(f)
+	if err != nil {
+		return fmt.Errorf("function %q: %w", l.prefix+name, err)
+	}
+	l.add(name, fn)
+	return nil
+}
+
+// Merge copies all the functions from other into the library (using their
+// full names, regardless of namespace), replacing any with the same names.
+func (l *Library) Merge(other *Library) {
+	if l.funcs == nil {
+		l.funcs = make(map[string]*function)
+	}
+	for name, f := range other.funcs {
+		l.funcs[name] = f
+	}
+}
+
+// Declarations returns the declarations of all functions in the library,
+// sorted by name.
+func (l *Library) Declarations() []FunctionDeclaration {
+	decls := make([]FunctionDeclaration, 0, len(l.funcs))
+	for _, f := range l.funcs {
+		d := f.decl
+		d.Parameters = append([]YarnType{}, d.Parameters...)
+		decls = append(decls, d)
+	}
+	sort.Slice(decls, func(i, j int) bool { return decls[i].Name < decls[j].Name })
+	return decls
+}
+
+// Register0 adds a function with no parameters to the library.
+func Register0[R FuncArg](l *Library, name string, f func() R) {
+	l.add(name, newFunc0(f))
+}
+
+// Register1 adds a function with one parameter to the library.
+func Register1[A, R FuncArg](l *Library, name string, f func(A) R) {
+	l.add(name, newFunc1(f))
+}
+
+// Register2 adds a function with two parameters to the library.
+func Register2[A, B, R FuncArg](l *Library, name string, f func(A, B) R) {
+	l.add(name, newFunc2(f))
+}
+
+// Register3 adds a function with three parameters to the library.
+func Register3[A, B, C, R FuncArg](l *Library, name string, f func(A, B, C) R) {
+	l.add(name, newFunc3(f))
+}
+
+// RegisterVariadic adds a function with any number of parameters of the same
+// type to the library.
+func RegisterVariadic[A, R FuncArg](l *Library, name string, f func(...A) R) {
+	l.add(name, newFuncVariadic(f))
+}
+
+func newFunc0[R FuncArg](f func() R) *function {
+	cr := resultConverter[R]()
+	return &function{
+		decl: FunctionDeclaration{
+			Parameters: []YarnType{},
+			Returns:    yarnTypeOf[R](),
+		},
+		call: func(*VirtualMachine, []Value) (Value, bool, error) {
+			return cr(f()), true, nil
+		},
+	}
+}
+
+func newFunc1[A, R FuncArg](f func(A) R) *function {
+	ca, cr := argConverter[A](), resultConverter[R]()
+	return &function{
+		decl: FunctionDeclaration{
+			Parameters: []YarnType{yarnTypeOf[A]()},
+			Returns:    yarnTypeOf[R](),
+		},
+		call: func(_ *VirtualMachine, args []Value) (Value, bool, error) {
+			a, err := ca(args[0])
+			if err != nil {
+				return Value{}, false, argError(0, err)
+			}
+			return cr(f(a)), true, nil
+		},
+	}
+}
+
+func newFunc2[A, B, R FuncArg](f func(A, B) R) *function {
+	ca, cb, cr := argConverter[A](), argConverter[B](), resultConverter[R]()
+	return &function{
+		decl: FunctionDeclaration{
+			Parameters: []YarnType{yarnTypeOf[A](), yarnTypeOf[B]()},
+			Returns:    yarnTypeOf[R](),
+		},
+		call: func(_ *VirtualMachine, args []Value) (Value, bool, error) {
+			a, err := ca(args[0])
+			if err != nil {
+				return Value{}, false, argError(0, err)
+			}
+			b, err := cb(args[1])
+			if err != nil {
+				return Value{}, false, argError(1, err)
+			}
+			return cr(f(a, b)), true, nil
+		},
+	}
+}
+
+func newFunc3[A, B, C, R FuncArg](f func(A, B, C) R) *function {
+	ca, cb, cc, cr := argConverter[A](), argConverter[B](), argConverter[C](), resultConverter[R]()
+	return &function{
+		decl: FunctionDeclaration{
+			Parameters: []YarnType{yarnTypeOf[A](), yarnTypeOf[B](), yarnTypeOf[C]()},
+			Returns:    yarnTypeOf[R](),
+		},
+		call: func(_ *VirtualMachine, args []Value) (Value, bool, error) {
+			a, err := ca(args[0])
+			if err != nil {
+				return Value{}, false, argError(0, err)
+			}
+			b, err := cb(args[1])
+			if err != nil {
+				return Value{}, false, argError(1, err)
+			}
+			c, err := cc(args[2])
+			if err != nil {
+				return Value{}, false, argError(2, err)
+			}
+			return cr(f(a, b, c)), true, nil
+		},
+	}
+}
+
+func newFuncVariadic[A, R FuncArg](f func(...A) R) *function {
+	ca, cr := argConverter[A](), resultConverter[R]()
+	return &function{
+		decl: FunctionDeclaration{
+			Parameters: []YarnType{yarnTypeOf[A]()},
+			Variadic:   true,
+			Returns:    yarnTypeOf[R](),
+		},
+		call: func(_ *VirtualMachine, args []Value) (Value, bool, error) {
+			as := make([]A, len(args))
+			for i, arg := range args {
+				a, err := ca(arg)
+				if err != nil {
+					return Value{}, false, argError(i, err)
+				}
+				as[i] = a
+			}
+			return cr(f(as...)), true, nil
+		},
+	}
+}
+
+// argumentError is an error converting an argument for a function, as
+// opposed to an error returned by the function itself.
+type argumentError struct {
+	i   int
+	err error
+}
+
+func (e *argumentError) Error() string { return fmt.Sprintf("argument %d: %v", e.i, e.err) }
+func (e *argumentError) Unwrap() error { return e.err }
+
+func argError(i int, err error) error {
+	return &argumentError{i: i, err: err}
+}
+
+// yarnTypeOf returns the Yarn type corresponding to A.
+func yarnTypeOf[A FuncArg]() YarnType {
+	var zero A
+	switch any(zero).(type) {
+	case bool:
+		return YarnTypeBool
+	case float32, float64, int:
+		return YarnTypeNumber
+	case string:
+		return YarnTypeString
+	}
+	return YarnTypeAny
+}
+
+// argConverter returns a func that converts a Value into an A. Null is
+// converted to the zero value.
+func argConverter[A FuncArg]() func(Value) (A, error) {
+	var zero A
+	var conv any
+	switch any(zero).(type) {
+	case bool:
+		conv = func(v Value) (bool, error) { return v.Bool(), nil }
+	case float32:
+		conv = Value.Float32
+	case float64:
+		conv = Value.Number
+	case int:
+		conv = Value.Int
+	case string:
+		conv = func(v Value) (string, error) {
+			if v.IsNull() {
+				return "", nil
+			}
+			return v.String(), nil
+		}
+	case Value:
+		conv = func(v Value) (Value, error) { return v, nil }
+	}
+	return conv.(func(Value) (A, error))
+}
+
+// resultConverter returns a func that converts an R into a Value.
+func resultConverter[R FuncArg]() func(R) Value {
+	var zero R
+	var conv any
+	switch any(zero).(type) {
+	case bool:
+		conv = BoolValue
+	case float32:
+		conv = func(x float32) Value { return NumberValue(float64(x)) }
+	case float64:
+		conv = NumberValue
+	case int:
+		conv = func(x int) Value { return NumberValue(float64(x)) }
+	case string:
+		conv = StringValue
+	case Value:
+		conv = func(v Value) Value { return v }
+	}
+	return conv.(func(R) Value)
+}
+
+// newFunction creates a function from a func of any supported signature.
+func newFunction(f any) (*function, error) {
+	// Signatures used by the default functions (and likely by others) get
+	// reflection-free adapters.
+	switch f := f.(type) {
+	case func() float32:
+		return newFunc0(f), nil
+	case func() bool:
+		return newFunc0(f), nil
+	case func() string:
+		return newFunc0(f), nil
+	case func(bool) bool:
+		return newFunc1(f), nil
+	case func(float32) float32:
+		return newFunc1(f), nil
+	case func(int) float32:
+		return newFunc1(f), nil
+	case func(bool, bool) bool:
+		return newFunc2(f), nil
+	case func(float32, float32) bool:
+		return newFunc2(f), nil
+	case func(float32, float32) float32:
+		return newFunc2(f), nil
+	case func(int, int) float32:
+		return newFunc2(f), nil
+	case func() float64:
+		return newFunc0(f), nil
+	case func(float64) float64:
+		return newFunc1(f), nil
+	case func(int) float64:
+		return newFunc1(f), nil
+	case func(float64, float64) bool:
+		return newFunc2(f), nil
+	case func(float64, float64) float64:
+		return newFunc2(f), nil
+	case func(int, int) float64:
+		return newFunc2(f), nil
+	case func(string, string) bool:
+		return newFunc2(f), nil
+	case func(string, string) string:
+		return newFunc2(f), nil
+	case func(any) any:
+		return &function{
+			decl: FunctionDeclaration{
+				Parameters: []YarnType{YarnTypeAny},
+				Returns:    YarnTypeAny,
+			},
+			call: func(_ *VirtualMachine, args []Value) (Value, bool, error) {
+				return anyResult(f(args[0].Interface()), nil)
+			},
+		}, nil
+	case func(any, any) bool:
+		return &function{
+			decl: FunctionDeclaration{
+				Parameters: []YarnType{YarnTypeAny, YarnTypeAny},
+				Returns:    YarnTypeBool,
+			},
+			call: func(_ *VirtualMachine, args []Value) (Value, bool, error) {
+				return BoolValue(f(args[0].Interface(), args[1].Interface())), true, nil
+			},
+		}, nil
+	case func(any, any) (any, error):
+		return &function{
+			decl: FunctionDeclaration{
+				Parameters: []YarnType{YarnTypeAny, YarnTypeAny},
+				Returns:    YarnTypeAny,
+			},
+			call: func(_ *VirtualMachine, args []Value) (Value, bool, error) {
+				return anyResult(f(args[0].Interface(), args[1].Interface()))
+			},
+		}, nil
+	}
+	return newReflectFunction(f)
+}
+
+// anyResult converts a result of type any into a Value. Results that aren't
+// one of the Yarn Spinner types become opaque values.
+func anyResult(x any, err error) (Value, bool, error) {
+	if err != nil {
+		return Value{}, false, err
+	}
+	return valueOrOpaque(x), true, nil
+}
+
+// newReflectFunction creates a function that uses reflection to call f.
+func newReflectFunction(f any) (*function, error) {
+	functype := reflect.TypeOf(f)
+	if functype == nil || functype.Kind() != reflect.Func {
+		return nil, fmt.Errorf("%w: not actually a function [type %T]", ErrWrongType, f)
+	}
+
+	// Check that function returns between 0 and 2 args; if there are two,
+	// the second is only allowed to be type error.
+	switch functype.NumOut() {
+	case 0, 1:
+		// ok
+	case 2:
+		if functype.Out(1) != errorType {
+			return nil, fmt.Errorf("%w: wrong type for second return arg [got %s, want error]", ErrFunctionArgMismatch, functype.Out(1).Name())
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported number of return args [got %d, want in {0,1,2}]", ErrFunctionArgMismatch, functype.NumOut())
+	}
+	hasResult := functype.NumOut() > 0 && functype.Out(0) != errorType
+	hasErr := functype.NumOut() > 0 && functype.Out(functype.NumOut()-1) == errorType
+
+	// A leading context.Context or *CallContext parameter is provided by the
+	// VM, rather than the program.
+	var ctxType reflect.Type
+	if functype.NumIn() > 0 {
+		switch t := functype.In(0); t {
+		case contextType, callContextType:
+			ctxType = t
+		}
+	}
+	offset := 0
+	if ctxType != nil {
+		offset = 1
+	}
+
+	fn := &function{
+		decl: FunctionDeclaration{
+			Parameters: make([]YarnType, functype.NumIn()-offset),
+			Variadic:   functype.IsVariadic(),
+		},
+	}
+	convs := make([]func(Value) (reflect.Value, error), functype.NumIn()-offset)
+	for i := range convs {
+		argtype := functype.In(i + offset)
+		if functype.IsVariadic() && i+offset == functype.NumIn()-1 {
+			// last arg is reported by reflect as a slice type
+			argtype = argtype.Elem()
+		}
+		convs[i] = reflectArgConverter(argtype)
+		fn.decl.Parameters[i] = reflectYarnType(argtype)
+	}
+	if hasResult {
+		fn.decl.Returns = reflectYarnType(functype.Out(0))
+	}
+
+	fv := reflect.ValueOf(f)
+	fn.call = func(vm *VirtualMachine, args []Value) (Value, bool, error) {
+		params := make([]reflect.Value, offset+len(args))
+		if ctxType != nil {
+			cc, done := vm.callContext()
+			defer done()
+			if ctxType == contextType {
+				params[0] = reflect.ValueOf(&cc.Context).Elem()
+			} else {
+				params[0] = reflect.ValueOf(cc)
+			}
+		}
+		for i, arg := range args {
+			c := convs[min(i, len(convs)-1)]
+			p, err := c(arg)
+			if err != nil {
+				return Value{}, false, argError(i, err)
+			}
+			params[offset+i] = p
+		}
+		result := fv.Call(params)
+		if hasErr && !result[len(result)-1].IsNil() {
+			return Value{}, false, result[len(result)-1].Interface().(error)
+		}
+		if !hasResult {
+			return Value{}, false, nil
+		}
+		return anyResult(result[0].Interface(), nil)
+	}
+	return fn, nil
+}
+
+// reflectYarnType returns the Yarn type corresponding to a Go type.
+func reflectYarnType(t reflect.Type) YarnType {
+	switch t.Kind() {
+	case reflect.Bool:
+		return YarnTypeBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return YarnTypeNumber
+	case reflect.String:
+		return YarnTypeString
+	}
+	return YarnTypeAny
+}
+
+// reflectArgConverter returns a func that converts a Value into a
+// reflect.Value suitable for passing as an argument of type argtype.
+func reflectArgConverter(argtype reflect.Type) func(Value) (reflect.Value, error) {
+	if argtype == valueType {
+		// The function wants the Value as-is.
+		return func(v Value) (reflect.Value, error) { return reflect.ValueOf(v), nil }
+	}
+	var conv func(Value) (any, error)
+	switch argtype {
+	case stringType:
+		conv = func(v Value) (any, error) { return v.String(), nil }
+	case float32Type:
+		conv = func(v Value) (any, error) { return v.Float32() }
+	case float64Type:
+		conv = func(v Value) (any, error) { return v.Number() }
+	case intType:
+		conv = func(v Value) (any, error) { return v.Int() }
+	case boolType:
+		conv = func(v Value) (any, error) { return v.Bool(), nil }
+	default:
+		if reflectYarnType(argtype) == YarnTypeNumber {
+			// Other integer and floating-point types.
+			conv = func(v Value) (any, error) {
+				n, err := v.Number()
+				if err != nil {
+					return nil, err
+				}
+				switch argtype.Kind() {
+				case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+					if n < 0 {
+						return nil, fmt.Errorf("%w: negative value %v for [type %v]", ErrFunctionArgMismatch, n, argtype)
+					}
+				}
+				return reflect.ValueOf(n).Convert(argtype).Interface(), nil
+			}
+			break
+		}
+		conv = func(v Value) (any, error) {
+			p := v.Interface()
+			if !reflect.TypeOf(p).AssignableTo(argtype) {
+				return nil, fmt.Errorf("%w: value %v [type %T] not assignable or convertible to [type %v]", ErrFunctionArgMismatch, p, p, argtype)
+			}
+			return p, nil
+		}
+	}
+	zero := reflect.Zero(argtype)
+	return func(v Value) (reflect.Value, error) {
+		if v.IsNull() {
+			// substitute nil param with a zero value, because nil Value can't
+			// be used.
+			return zero, nil
+		}
+		p, err := conv(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(p), nil
+	}
+}
@@ -0,0 +1,368 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	yarnpb "drjosh.dev/yarn/bytecode"
+	"github.com/google/go-cmp/cmp"
+)
+
+// callProgram returns a program that calls a function with some arguments,
+// and stores the result in $result.
+func callProgram(funcname string, args ...Value) *yarnpb.Program {
+	node := &yarnpb.Node{Name: "Start"}
+	for _, arg := range append(args, NumberValue(float64(len(args)))) {
+		inst := &yarnpb.Instruction{Operands: []*yarnpb.Operand{arg.Operand()}}
+		switch arg.Kind() {
+		case BoolKind:
+			inst.Opcode = yarnpb.Instruction_PUSH_BOOL
+		case NumberKind:
+			inst.Opcode = yarnpb.Instruction_PUSH_FLOAT
+		case StringKind:
+			inst.Opcode = yarnpb.Instruction_PUSH_STRING
+		default:
+			inst = &yarnpb.Instruction{Opcode: yarnpb.Instruction_PUSH_NULL}
+		}
+		node.Instructions = append(node.Instructions, inst)
+	}
+	node.Instructions = append(node.Instructions,
+		&yarnpb.Instruction{
+			Opcode:   yarnpb.Instruction_CALL_FUNC,
+			Operands: []*yarnpb.Operand{StringValue(funcname).Operand()},
+		},
+		&yarnpb.Instruction{
+			Opcode:   yarnpb.Instruction_STORE_VARIABLE,
+			Operands: []*yarnpb.Operand{StringValue("$result").Operand()},
+		},
+		&yarnpb.Instruction{Opcode: yarnpb.Instruction_STOP},
+	)
+	return &yarnpb.Program{Nodes: map[string]*yarnpb.Node{"Start": node}}
+}
+
+// testLibrary returns a library with a few functions in a namespace.
+func testLibrary(t testing.TB) *Library {
+	l := NewLibrary()
+	game := l.Namespace("Game")
+	Register2(game, "repeat", strings.Repeat)
+	Register1(game, "is_even", func(n int) bool { return n%2 == 0 })
+	RegisterVariadic(game, "sum", func(xs ...float64) float64 {
+		total := 0.0
+		for _, x := range xs {
+			total += x
+		}
+		return total
+	})
+	if err := game.Register("fail", func() (bool, error) { return false, errDummy }); err != nil {
+		t.Fatalf("Register(fail) = %v", err)
+	}
+	return l
+}
+
+func TestLibraryCalls(t *testing.T) {
+	tests := []struct {
+		funcname string
+		args     []Value
+		want     Value
+	}{
+		{"Game.repeat", []Value{StringValue("ab"), NumberValue(3)}, StringValue("ababab")},
+		{"Game.is_even", []Value{NumberValue(4)}, BoolValue(true)},
+		{"Game.is_even", []Value{StringValue("7")}, BoolValue(false)},
+		{"Game.sum", nil, NumberValue(0)},
+		{"Game.sum", []Value{NumberValue(1), NumberValue(2.5), BoolValue(true)}, NumberValue(4.5)},
+		{"Number.Add", []Value{NumberValue(1), NumberValue(2)}, NumberValue(3)},
+		{"Add", []Value{StringValue("a"), NumberValue(2)}, StringValue("a2")},
+		{"None", []Value{StringValue("x")}, StringValue("x")},
+		{"round_places", []Value{NumberValue(1.5), NumberValue(3)}, NumberValue(1.5)},
+	}
+	for _, test := range tests {
+		vars := NewTypedMapVariableStorage()
+		vm := &VirtualMachine{
+			Program: callProgram(test.funcname, test.args...),
+			Handler: FakeDialogueHandler{},
+			Vars:    vars,
+			Library: testLibrary(t),
+		}
+		if err := vm.Run("Start"); err != nil {
+			t.Errorf("%s(%v): vm.Run(Start) = %v", test.funcname, test.args, err)
+			continue
+		}
+		if got, _ := vars.GetTypedValue("$result"); !got.Equal(test.want) {
+			t.Errorf("%s(%v) = %v, want %v", test.funcname, test.args, got, test.want)
+		}
+	}
+}
+
+func TestRoundPlaces(t *testing.T) {
+	tests := []struct {
+		n       float64
+		places  uint
+		bitSize int
+		want    float64
+	}{
+		{3.14159, 2, 64, 3.14},
+		{3.14159, 0, 64, 3},
+		{2.5, 0, 64, 2},
+		{3.5, 0, 64, 4},
+		{-1.25, 1, 64, -1.2},
+		{1234.5678, 1, 64, 1234.6},
+		{1234.5678, 1, 32, float64(float32(1234.6))},
+		{1.5, 3, 64, 1.5},
+		{0.1, 20, 64, 0.1}, // at most 15 places
+	}
+	for _, test := range tests {
+		if got := roundPlaces(test.n, test.places, test.bitSize); got != test.want {
+			t.Errorf("roundPlaces(%v, %d, %d) = %v, want %v", test.n, test.places, test.bitSize, got, test.want)
+		}
+	}
+
+	for _, mode := range []NumericMode{NumericFloat32, NumericFloat64} {
+		vars := NewTypedMapVariableStorage()
+		vm := &VirtualMachine{
+			Program:     callProgram("round_places", NumberValue(3.14159), NumberValue(2)),
+			Handler:     FakeDialogueHandler{},
+			Vars:        vars,
+			NumericMode: mode,
+		}
+		if err := vm.Run("Start"); err != nil {
+			t.Errorf("%v: vm.Run(Start) = %v", mode, err)
+			continue
+		}
+		want := 3.14
+		if mode == NumericFloat32 {
+			want = float64(float32(want))
+		}
+		if got, _ := vars.GetTypedValue("$result"); !got.Equal(NumberValue(want)) {
+			t.Errorf("%v: round_places(3.14159, 2) = %v, want %v", mode, got, want)
+		}
+	}
+}
+
+func TestLibraryErrors(t *testing.T) {
+	tests := []struct {
+		funcname string
+		args     []Value
+		want     error
+	}{
+		{"Game.fail", nil, errDummy},
+		{"Game.missing", nil, ErrFunctionNotFound},
+		{"Game.repeat", []Value{StringValue("ab")}, ErrFunctionArgMismatch},
+		{"round_places", []Value{NumberValue(1.5), NumberValue(-1)}, ErrFunctionArgMismatch},
+	}
+	for _, test := range tests {
+		vm := &VirtualMachine{
+			Program: callProgram(test.funcname, test.args...),
+			Handler: FakeDialogueHandler{},
+			Vars:    NewMapVariableStorage(),
+			Library: testLibrary(t),
+		}
+		if err := vm.Run("Start"); !errors.Is(err, test.want) {
+			t.Errorf("%s(%v): vm.Run(Start) = %v, want %v", test.funcname, test.args, err, test.want)
+		}
+	}
+
+	if err := NewLibrary().Register("x", 42); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Register(x, 42) = %v, want %v", err, ErrWrongType)
+	}
+	if err := NewLibrary().Register("x", func() (int, int) { return 0, 0 }); !errors.Is(err, ErrFunctionArgMismatch) {
+		t.Errorf("Register(x, func() (int, int)) = %v, want %v", err, ErrFunctionArgMismatch)
+	}
+}
+
+func TestLibraryPrecedenceAndFuncMap(t *testing.T) {
+	fm := FuncMap{
+		"answer": func() float32 { return 1 },
+		"floor":  func(float32) float32 { return -1 }, // overrides built-in
+	}
+	l := NewLibrary()
+	Register0(l, "answer", func() int { return 42 }) // overrides FuncMap
+
+	for funcname, want := range map[string]Value{
+		"answer": NumberValue(42),
+		"floor":  NumberValue(-1),
+	} {
+		vars := NewTypedMapVariableStorage()
+		vm := &VirtualMachine{
+			Program: callProgram(funcname, NumberValue(2.5)),
+			Handler: FakeDialogueHandler{},
+			Vars:    vars,
+			FuncMap: fm,
+			Library: l,
+		}
+		if funcname == "answer" {
+			vm.Program = callProgram(funcname)
+		}
+		if err := vm.Run("Start"); err != nil {
+			t.Fatalf("vm.Run(Start) = %v", err)
+		}
+		if got, _ := vars.GetTypedValue("$result"); !got.Equal(want) {
+			t.Errorf("%s() = %v, want %v", funcname, got, want)
+		}
+	}
+	if got, want := len(fm), 2; got != want {
+		t.Errorf("after Run, len(FuncMap) = %d, want %d", got, want)
+	}
+
+	// Unsupported functions in FuncMap are only an error if called.
+	vm := &VirtualMachine{
+		Program: callProgram("floor", NumberValue(2.5)),
+		Handler: FakeDialogueHandler{},
+		Vars:    NewMapVariableStorage(),
+		FuncMap: FuncMap{"bad": "not a function"},
+	}
+	if err := vm.Run("Start"); err != nil {
+		t.Errorf("vm.Run(Start) with unused bad FuncMap entry = %v", err)
+	}
+	vm.Program = callProgram("bad")
+	if err := vm.Run("Start"); !errors.Is(err, ErrWrongType) || !strings.Contains(err.Error(), `"bad"`) {
+		t.Errorf("vm.Run(Start) calling bad FuncMap entry = %v, want %v naming the function", err, ErrWrongType)
+	}
+}
+
+func TestLibraryDeclarations(t *testing.T) {
+	l, err := LibraryFromFuncMap(FuncMap{
+		"last_value": func(x ...any) (any, error) { return x[len(x)-1], nil },
+		"assert":     func(any) error { return nil },
+	})
+	if err != nil {
+		t.Fatalf("LibraryFromFuncMap = %v", err)
+	}
+	l.Merge(testLibrary(t))
+	got, err := json.Marshal(l.Declarations())
+	if err != nil {
+		t.Fatalf("json.Marshal = %v", err)
+	}
+	want := `[` +
+		`{"name":"Game.fail","parameters":[],"returns":"Bool"},` +
+		`{"name":"Game.is_even","parameters":["Number"],"returns":"Bool"},` +
+		`{"name":"Game.repeat","parameters":["String","Number"],"returns":"String"},` +
+		`{"name":"Game.sum","parameters":["Number"],"variadic":true,"returns":"Number"},` +
+		`{"name":"assert","parameters":["Any"]},` +
+		`{"name":"last_value","parameters":["Any"],"variadic":true,"returns":"Any"}` +
+		`]`
+	if diff := cmp.Diff(string(got), want); diff != "" {
+		t.Errorf("declarations diff (-got +want):\n%s", diff)
+	}
+
+	decls := DefaultLibrary().Declarations()
+	if len(decls) == 0 {
+		t.Error("DefaultLibrary().Declarations() is empty")
+	}
+}
+
+func TestLibraryNoReflection(t *testing.T) {
+	l := NewLibrary()
+	Register2(l, "add", func(x, y float32) float32 { return x + y })
+	f := l.lookup("add")
+	args := []Value{NumberValue(1), StringValue("2")}
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, _, err := f.call(nil, args); err != nil {
+			t.Fatalf("call = %v", err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("allocs per call = %v, want 0", allocs)
+	}
+}
+
+func BenchmarkCallFunc(b *testing.B) {
+	f := func(x, y float32) float32 { return x + y }
+	fm := func(x, y float32, z ...any) float32 { return x + y } // not a fast path
+	l := NewLibrary()
+	Register2(l, "add", f)
+	libs := []struct {
+		name string
+		vm   *VirtualMachine
+	}{
+		{"Library", &VirtualMachine{Library: l}},
+		{"FuncMapReflect", &VirtualMachine{FuncMap: FuncMap{"add": fm}}},
+	}
+	for _, lib := range libs {
+		b.Run(lib.name, func(b *testing.B) {
+			vm := lib.vm
+			vm.Program = callProgram("add", NumberValue(1), NumberValue(2))
+			vm.Handler = FakeDialogueHandler{}
+			vm.Vars = NewTypedMapVariableStorage()
+			b.ReportAllocs()
+			for b.Loop() {
+				if err := vm.Run("Start"); err != nil {
+					b.Fatalf("vm.Run(Start) = %v", err)
+				}
+			}
+		})
+	}
+}
+
+type testCtxKey struct{}
+
+func TestFunctionContextParams(t *testing.T) {
+	var gotCC *CallContext
+	l := NewLibrary()
+	err := l.Register("has_item", func(cc *CallContext, item string) bool {
+		gotCC = cc
+		inv := cc.Session["inventory"].([]string)
+		return slices.Contains(inv, item)
+	})
+	if err != nil {
+		t.Fatalf("Register(has_item) = %v", err)
+	}
+	err = l.Register("ctx_value", func(ctx context.Context) string {
+		return ctx.Value(testCtxKey{}).(string)
+	})
+	if err != nil {
+		t.Fatalf("Register(ctx_value) = %v", err)
+	}
+
+	want := []FunctionDeclaration{
+		{Name: "ctx_value", Parameters: []YarnType{}, Returns: YarnTypeString},
+		{Name: "has_item", Parameters: []YarnType{YarnTypeString}, Returns: YarnTypeBool},
+	}
+	if diff := cmp.Diff(l.Declarations(), want); diff != "" {
+		t.Errorf("declarations diff (-got +want):\n%s", diff)
+	}
+
+	vars := NewTypedMapVariableStorage()
+	vm := &VirtualMachine{
+		Program: callProgram("has_item", StringValue("sword")),
+		Handler: FakeDialogueHandler{},
+		Vars:    vars,
+		Library: l,
+		Session: map[string]any{"inventory": []string{"shield", "sword"}},
+	}
+	if err := vm.Run("Start"); err != nil {
+		t.Fatalf("vm.Run(Start) = %v", err)
+	}
+	if got, _ := vars.GetTypedValue("$result"); !got.Equal(BoolValue(true)) {
+		t.Errorf("has_item(sword) = %v, want true", got)
+	}
+	if gotCC.VM != vm || gotCC.Vars != VariableStorage(vars) || gotCC.Node != "Start" {
+		t.Errorf("CallContext = {VM: %p, Vars: %v, Node: %q}, want {VM: %p, Vars: %v, Node: Start}", gotCC.VM, gotCC.Vars, gotCC.Node, vm, vars)
+	}
+
+	vm.Program = callProgram("ctx_value")
+	ctx := context.WithValue(context.Background(), testCtxKey{}, "session 1")
+	if err := vm.RunContext(ctx, "Start"); err != nil {
+		t.Fatalf("vm.RunContext(Start) = %v", err)
+	}
+	if got, _ := vars.GetTypedValue("$result"); !got.Equal(StringValue("session 1")) {
+		t.Errorf("ctx_value() = %v, want session 1", got)
+	}
+}
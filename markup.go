@@ -0,0 +1,171 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"fmt"
+
+	"golang.org/x/text/language"
+)
+
+// maxMarkupDepth limits how deeply MarkupRenderer.WriteMarkup can nest, to
+// catch processors that (indirectly) expand to themselves.
+const maxMarkupDepth = 32
+
+// MarkupTagKind is the kind of a markup tag: opening ([b]), closing ([/b]),
+// or self-closing ([b/]).
+type MarkupTagKind int
+
+// Kinds of markup tag.
+const (
+	OpeningTag MarkupTagKind = iota
+	ClosingTag
+	SelfClosingTag
+)
+
+func (k MarkupTagKind) String() string {
+	switch k {
+	case OpeningTag:
+		return "opening"
+	case ClosingTag:
+		return "closing"
+	case SelfClosingTag:
+		return "self-closing"
+	default:
+		return fmt.Sprintf("(invalid MarkupTagKind %d)", k)
+	}
+}
+
+// MarkupTag describes a markup tag being rendered. Props contains the
+// properties of the tag (see Attribute); closing tags have no properties.
+type MarkupTag struct {
+	Name  string
+	Kind  MarkupTagKind
+	Props map[string]Value
+}
+
+// MarkupProcessor implements a custom markup tag. It is called by Render for
+// each opening, closing, and self-closing tag with the name it is registered
+// under, in place of the usual processing. It can write replacement text, and
+// add attributes (including the default attribute for the tag, with
+// r.DefaultTag). If it does neither, the tag is removed from the output.
+//
+// Unlike other self-closing tags, self-closing tags handled by a
+// MarkupProcessor do not trim the whitespace following them (the same as
+// format functions such as select and plural).
+type MarkupProcessor func(r *MarkupRenderer, tag MarkupTag) error
+
+// MarkupProcessorMap maps markup tag names to processors. It is similar to
+// CommandMap, but for markup tags. The built-in format functions (select,
+// plural, ordinal) can be overridden by adding an entry with the same name.
+// Adding an entry with a nil MarkupProcessor causes the tag to be processed
+// as usual.
+type MarkupProcessorMap map[string]MarkupProcessor
+
+// MarkupRenderer is passed to a MarkupProcessor to give it access to the line
+// being rendered.
+type MarkupRenderer struct {
+	b *lineRenderer
+}
+
+// Language returns the language the line is being rendered in.
+func (r *MarkupRenderer) Language() language.Tag { return r.b.lang }
+
+// Substitutions returns the substitutions for the line.
+func (r *MarkupRenderer) Substitutions() []string { return r.b.substs }
+
+// Values returns the typed substitutions for the line, if they are available
+// (see StringTable.Render).
+func (r *MarkupRenderer) Values() []Value { return r.b.values }
+
+// Len returns the length (in bytes) of the text rendered so far.
+func (r *MarkupRenderer) Len() int { return r.b.builder.Len() }
+
+// WriteString writes replacement text to the output. The text is not parsed
+// for markup (see WriteMarkup).
+func (r *MarkupRenderer) WriteString(s string) {
+	r.b.builder.WriteString(s)
+}
+
+// WriteMarkup parses s as markup (including substitution tokens such as {0},
+// and any custom tags) and renders it into the output. Tags in s can be
+// closed by later tags in the line, and vice versa.
+func (r *MarkupRenderer) WriteMarkup(s string) error {
+	if r.b.depth >= maxMarkupDepth {
+		return fmt.Errorf("markup nested too deeply (%d levels)", r.b.depth)
+	}
+	pt, err := lineParser.ParseString("", s)
+	if err != nil {
+		return fmt.Errorf("parsing replacement markup %q: %w", s, err)
+	}
+	r.b.depth++
+	defer func() { r.b.depth-- }()
+	return r.b.renderString(pt)
+}
+
+// OpenAttribute starts an attribute at the current position. It must be
+// closed with CloseAttribute, or by a close-all tag [/] or the end of the
+// line.
+func (r *MarkupRenderer) OpenAttribute(name string, props map[string]Value) {
+	r.b.openAttribute(name, props)
+}
+
+// CloseAttribute ends the most recently opened attribute with the name.
+func (r *MarkupRenderer) CloseAttribute(name string) error {
+	return r.b.closeTag(name)
+}
+
+// DefaultTag processes the tag in the usual way, opening and/or closing an
+// attribute with the tag's name and properties.
+func (r *MarkupRenderer) DefaultTag(tag MarkupTag) error {
+	if tag.Kind != ClosingTag {
+		r.b.openAttribute(tag.Name, tag.Props)
+	}
+	if tag.Kind != OpeningTag {
+		return r.b.closeTag(tag.Name)
+	}
+	return nil
+}
+
+// runProcessor calls the processor for the tag f, if there is one, and
+// reports whether it did.
+func (b *lineRenderer) runProcessor(f *parsedMarkupTag) (bool, error) {
+	if f.Name == "" || (f.OpeningSlash == "/" && f.Value != nil) {
+		// Close-all tag
+		return false, nil
+	}
+	proc := b.procs[f.Name]
+	if proc == nil {
+		return false, nil
+	}
+	tag := MarkupTag{Name: f.Name}
+	switch {
+	case f.OpeningSlash == "/":
+		tag.Kind = ClosingTag
+	case f.ClosingSlash == "/":
+		tag.Kind = SelfClosingTag
+	}
+	if tag.Kind != ClosingTag {
+		props, err := b.evalProps(f)
+		if err != nil {
+			return true, err
+		}
+		tag.Props = props
+	}
+	if err := proc(&MarkupRenderer{b: b}, tag); err != nil {
+		return true, fmt.Errorf("markup processor for %q: %w", f.Name, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/text/language"
+)
+
+func testMarkupProcessors() MarkupProcessorMap {
+	return MarkupProcessorMap{
+		"playername": func(r *MarkupRenderer, tag MarkupTag) error {
+			r.WriteString("Mae")
+			return nil
+		},
+		"icon": func(r *MarkupRenderer, tag MarkupTag) error {
+			r.WriteString("<" + tag.Props["name"].String() + ">")
+			return r.DefaultTag(tag)
+		},
+		"secret": func(*MarkupRenderer, MarkupTag) error { return nil },
+		"shout": func(r *MarkupRenderer, tag MarkupTag) error {
+			return r.WriteMarkup("[b]{0}![/b]")
+		},
+		"lang": func(r *MarkupRenderer, tag MarkupTag) error {
+			r.WriteString(r.Language().String())
+			return nil
+		},
+		"select": func(r *MarkupRenderer, tag MarkupTag) error {
+			r.WriteString("overridden")
+			return nil
+		},
+		"loop": func(r *MarkupRenderer, tag MarkupTag) error {
+			return r.WriteMarkup("[loop/]")
+		},
+	}
+}
+
+func TestMarkupProcessors(t *testing.T) {
+	tests := []struct {
+		input    string
+		wantText string
+		wantAtts []*Attribute
+	}{
+		{
+			input:    "Hello, [playername/] !",
+			wantText: "Hello, Mae !",
+		},
+		{
+			input:    "[b][playername/][/b]",
+			wantText: "Mae",
+			wantAtts: []*Attribute{{Start: 0, End: 3, Name: "b"}},
+		},
+		{
+			input:    `Take the [icon name="sword"/]`,
+			wantText: "Take the <sword>",
+			wantAtts: []*Attribute{{Start: 16, End: 16, Name: "icon", Props: map[string]Value{
+				"name": StringValue("sword"),
+			}}},
+		},
+		{
+			input:    "[secret]Psst[/secret]",
+			wantText: "Psst",
+		},
+		{
+			input:    "[i][shout/][/i]",
+			wantText: "hey!",
+			wantAtts: []*Attribute{
+				{Start: 0, End: 4, Name: "i"},
+				{Start: 0, End: 4, Name: "b"},
+			},
+		},
+		{
+			input:    "[lang/]",
+			wantText: "en-AU",
+		},
+		{
+			input:    `[select value={0} hey="a" other="b"/]`,
+			wantText: "overridden",
+		},
+	}
+	st := &StringTable{
+		Language:         language.MustParse("en-AU"),
+		Table:            make(map[string]*StringTableRow),
+		MarkupProcessors: testMarkupProcessors(),
+	}
+	for _, test := range tests {
+		st.Table["line:1"] = &StringTableRow{ID: "line:1", Text: test.input}
+		as, err := st.Render(Line{ID: "line:1", Substitutions: []string{"hey"}})
+		if err != nil {
+			t.Errorf("Render(%q) = %v", test.input, err)
+			continue
+		}
+		if got := as.String(); got != test.wantText {
+			t.Errorf("Render(%q).String() = %q, want %q", test.input, got, test.wantText)
+		}
+		var gotAtts []*Attribute
+		as.ScanAttribEvents(func(pos int, atts []*Attribute) {
+			for _, a := range atts {
+				if a.Start == pos {
+					gotAtts = append(gotAtts, a)
+				}
+			}
+		})
+		if diff := cmp.Diff(gotAtts, test.wantAtts); diff != "" {
+			t.Errorf("Render(%q) attributes diff (-got +want):\n%s", test.input, diff)
+		}
+	}
+}
+
+func TestMarkupProcessorLoop(t *testing.T) {
+	st := &StringTable{
+		Language: language.English,
+		Table: map[string]*StringTableRow{
+			"line:1": {ID: "line:1", Text: "[loop/]"},
+		},
+		MarkupProcessors: testMarkupProcessors(),
+	}
+	if _, err := st.Render(Line{ID: "line:1"}); err == nil {
+		t.Error("Render([loop/]) = nil error, want error")
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// LastLineTag is the hashtag the Yarn Spinner compiler adds to the line
+// immediately before a set of options.
+const LastLineTag = "lastline"
+
+// SplitTags splits hashtags into bare tags, and key:value tags (as a map).
+// Leading '#'s are removed. Either result is nil if there are no tags of
+// that form.
+func SplitTags(tags []string) (bare []string, meta map[string]string) {
+	for _, tag := range tags {
+		tag = strings.TrimPrefix(tag, "#")
+		k, v, ok := strings.Cut(tag, ":")
+		if !ok {
+			bare = append(bare, tag)
+			continue
+		}
+		if meta == nil {
+			meta = make(map[string]string)
+		}
+		meta[k] = v
+	}
+	return bare, meta
+}
+
+// addMetadata fills in the Tags, Metadata, and Character of a line from the
+// VM's StringTable, if it has one. Lines that aren't in the table are left as
+// they are.
+func (vm *VirtualMachine) addMetadata(line *Line) error {
+	if vm.StringTable == nil {
+		return nil
+	}
+	row := vm.StringTable.Table[line.ID]
+	if row == nil {
+		return nil
+	}
+	line.Tags, line.Metadata = SplitTags(row.Tags)
+	// The line is rendered without markup processors or the MissingKeyFunc,
+	// so that they only run when the handler renders the line. Otherwise,
+	// the character name is the same as from rendering the line.
+	t := *vm.StringTable
+	t.MarkupProcessors, t.MissingKeyFunc = nil, nil
+	text, err := t.Render(*line)
+	if err != nil {
+		return fmt.Errorf("rendering line %q for its character name: %w", line.ID, err)
+	}
+	line.Character, _ = text.CharacterName()
+	return nil
+}
+
+// setLastLine records line as the line to attach to the next options, if it
+// is tagged #lastline.
+func (vm *VirtualMachine) setLastLine(line Line) {
+	vm.state.lastLine = nil
+	if slices.Contains(line.Tags, LastLineTag) {
+		vm.state.lastLine = &line
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"testing"
+
+	yarnpb "drjosh.dev/yarn/bytecode"
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/text/language"
+)
+
+func TestSplitTags(t *testing.T) {
+	bare, meta := SplitTags([]string{"lastline", "#emotion:happy", "voice:mae_01.ogg", "#shout", "time:10:30"})
+	if diff := cmp.Diff(bare, []string{"lastline", "shout"}); diff != "" {
+		t.Errorf("bare tags diff (-got +want):\n%s", diff)
+	}
+	wantMeta := map[string]string{
+		"emotion": "happy",
+		"voice":   "mae_01.ogg",
+		"time":    "10:30",
+	}
+	if diff := cmp.Diff(meta, wantMeta); diff != "" {
+		t.Errorf("metadata diff (-got +want):\n%s", diff)
+	}
+
+	bare, meta = SplitTags(nil)
+	if bare != nil || meta != nil {
+		t.Errorf("SplitTags(nil) = %v, %v, want nil, nil", bare, meta)
+	}
+}
+
+func TestLineMetadata(t *testing.T) {
+	prog, st, err := LoadFiles("testdata/Example.yarnc", "en")
+	if err != nil {
+		t.Fatalf("LoadFiles = %v", err)
+	}
+	handler := &optionPicker{pick: 0}
+	vm := &VirtualMachine{
+		Program:     prog,
+		Handler:     handler,
+		Vars:        NewMapVariableStorage(),
+		StringTable: st,
+	}
+	if err := vm.Run("Start"); err != nil {
+		t.Fatalf("vm.Run(Start) = %v", err)
+	}
+
+	const prefix = "line:/Users/kalexmills/repos/personal/yarn/testdata/Example.yarn-Start-"
+	wantLines := []Line{
+		{ID: prefix + "0", Character: "A"},
+		{ID: prefix + "1", Character: "B", Tags: []string{"lastline"}},
+		{ID: prefix + "3", Character: "A"},
+		{ID: prefix + "4", Character: "B"},
+		{ID: prefix + "6", Character: "A"},
+		{ID: prefix + "7", Character: "B", Tags: []string{"lastline"}},
+		{ID: "line:/Users/kalexmills/repos/personal/yarn/testdata/Example.yarn-Leave-10", Character: "A"},
+		{ID: "line:/Users/kalexmills/repos/personal/yarn/testdata/Example.yarn-Leave-11", Character: "B"},
+	}
+	lastLines := []*Line{&wantLines[1], &wantLines[5]}
+	if diff := cmp.Diff(handler.lines, wantLines); diff != "" {
+		t.Errorf("lines diff (-got +want):\n%s", diff)
+	}
+
+	if len(handler.options) != 2 {
+		t.Fatalf("got %d sets of options, want 2", len(handler.options))
+	}
+	for i, opts := range handler.options {
+		for _, opt := range opts {
+			if opt.Line.Character != "" {
+				t.Errorf("option %q Character = %q, want empty", opt.Line.ID, opt.Line.Character)
+			}
+			if diff := cmp.Diff(opt.LastLine, lastLines[i]); diff != "" {
+				t.Errorf("option %q LastLine diff (-got +want):\n%s", opt.Line.ID, diff)
+			}
+		}
+	}
+}
+
+func TestLineMetadataWithoutStringTable(t *testing.T) {
+	prog, _, err := LoadFiles("testdata/Example.yarnc", "en")
+	if err != nil {
+		t.Fatalf("LoadFiles = %v", err)
+	}
+	handler := &optionPicker{pick: 0}
+	vm := &VirtualMachine{
+		Program: prog,
+		Handler: handler,
+		Vars:    NewMapVariableStorage(),
+	}
+	if err := vm.Run("Start"); err != nil {
+		t.Fatalf("vm.Run(Start) = %v", err)
+	}
+	for _, line := range handler.lines {
+		if line.Character != "" || line.Tags != nil || line.Metadata != nil {
+			t.Errorf("line = %+v, want only ID and Substitutions", line)
+		}
+	}
+	for _, opts := range handler.options {
+		for _, opt := range opts {
+			if opt.LastLine != nil {
+				t.Errorf("option %q LastLine = %+v, want nil", opt.Line.ID, opt.LastLine)
+			}
+		}
+	}
+}
+
+func TestLineCharacterWithoutProcessors(t *testing.T) {
+	prog := &yarnpb.Program{Nodes: map[string]*yarnpb.Node{
+		"Start": {
+			Name: "Start",
+			Instructions: []*yarnpb.Instruction{
+				{Opcode: yarnpb.Instruction_RUN_LINE, Operands: []*yarnpb.Operand{StringValue("line:a").Operand()}},
+				{Opcode: yarnpb.Instruction_RUN_LINE, Operands: []*yarnpb.Operand{StringValue("line:b").Operand()}},
+				{Opcode: yarnpb.Instruction_RUN_LINE, Operands: []*yarnpb.Operand{StringValue("line:bad").Operand()}},
+				{Opcode: yarnpb.Instruction_STOP},
+			},
+		},
+	}}
+	calls := 0
+	st := &StringTable{
+		Language: language.English,
+		Table: map[string]*StringTableRow{
+			"line:a":   {ID: "line:a", Text: `[wave/]Mae: [select value="x" y="why" other="hmm" /]`},
+			"line:b":   {ID: "line:b", Text: `[select value="m" m="Mr" f="Ms" /] Smith: hi`},
+			"line:bad": {ID: "line:bad", Text: `Sam: [unclosed`},
+		},
+		MarkupProcessors: MarkupProcessorMap{
+			"wave": func(*MarkupRenderer, MarkupTag) error {
+				calls++
+				return nil
+			},
+		},
+		MissingKeys:    FallbackMissingKeys,
+		MissingKeyFunc: func(string, string, string) { calls++ },
+	}
+	handler := &lineRecorder{}
+	vm := &VirtualMachine{
+		Program:     prog,
+		Handler:     handler,
+		Vars:        NewMapVariableStorage(),
+		StringTable: st,
+	}
+	if err := vm.Run("Start"); err == nil {
+		t.Error("vm.Run(Start) = nil, want error for line:bad")
+	}
+	if calls != 0 {
+		t.Errorf("markup processor and MissingKeyFunc called %d times, want 0", calls)
+	}
+	want := []Line{
+		{ID: "line:a", Character: "Mae"},
+		{ID: "line:b", Character: "Mr Smith"},
+	}
+	if diff := cmp.Diff(handler.lines, want); diff != "" {
+		t.Errorf("lines diff (-got +want):\n%s", diff)
+	}
+
+	// The handler gets the same name by rendering the line.
+	for _, line := range handler.lines {
+		text, err := st.Render(line)
+		if err != nil {
+			t.Errorf("Render(%q) = %v", line.ID, err)
+			continue
+		}
+		if name, _ := text.CharacterName(); name != line.Character {
+			t.Errorf("Render(%q).CharacterName() = %q, but Line.Character = %q", line.ID, name, line.Character)
+		}
+	}
+}
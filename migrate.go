@@ -0,0 +1,238 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+
+	yarnpb "drjosh.dev/yarn/bytecode"
+)
+
+// ErrNoMigration is returned by Migrator.Migrate when there is no sequence of
+// registered migrations between the two versions.
+const ErrNoMigration = virtualMachineError("no migration path")
+
+// SchemaFingerprint returns a fingerprint of the variables declared in the
+// program: their names and kinds (but not their default values). Programs
+// with the same declared variables have the same fingerprint, so it can be
+// stored alongside saved variables (for example, as the version of a
+// FileVariableStorage) to detect when they need migrating.
+func SchemaFingerprint(prog *yarnpb.Program) string {
+	h := sha256.New()
+	for _, d := range DeclaredVariables(prog) {
+		fmt.Fprintf(h, "%q %v\n", d.Name, d.Kind())
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// RetypedVariable describes a declared variable whose kind has changed.
+type RetypedVariable struct {
+	Name     string
+	Old, New ValueKind
+}
+
+// ProgramDiff describes the differences between the declared variables and
+// nodes of two programs. All slices are sorted by name.
+type ProgramDiff struct {
+	AddedVariables   []string
+	RemovedVariables []string
+	RetypedVariables []RetypedVariable
+	AddedNodes       []string
+	RemovedNodes     []string
+}
+
+// Empty reports whether there are no differences.
+func (d *ProgramDiff) Empty() bool {
+	return len(d.AddedVariables) == 0 &&
+		len(d.RemovedVariables) == 0 &&
+		len(d.RetypedVariables) == 0 &&
+		len(d.AddedNodes) == 0 &&
+		len(d.RemovedNodes) == 0
+}
+
+// DiffPrograms compares the declared variables and nodes of two programs.
+// A renamed variable or node appears as one removal and one addition.
+func DiffPrograms(from, to *yarnpb.Program) *ProgramDiff {
+	d := &ProgramDiff{}
+	for name, op := range from.InitialValues {
+		top, found := to.InitialValues[name]
+		if !found {
+			d.RemovedVariables = append(d.RemovedVariables, name)
+			continue
+		}
+		fk, tk := valueFromOperand(op).Kind(), valueFromOperand(top).Kind()
+		if fk != tk {
+			d.RetypedVariables = append(d.RetypedVariables, RetypedVariable{Name: name, Old: fk, New: tk})
+		}
+	}
+	for name := range to.InitialValues {
+		if _, found := from.InitialValues[name]; !found {
+			d.AddedVariables = append(d.AddedVariables, name)
+		}
+	}
+	for name := range from.Nodes {
+		if _, found := to.Nodes[name]; !found {
+			d.RemovedNodes = append(d.RemovedNodes, name)
+		}
+	}
+	for name := range to.Nodes {
+		if _, found := from.Nodes[name]; !found {
+			d.AddedNodes = append(d.AddedNodes, name)
+		}
+	}
+	sort.Strings(d.AddedVariables)
+	sort.Strings(d.RemovedVariables)
+	sort.Slice(d.RetypedVariables, func(i, j int) bool {
+		return d.RetypedVariables[i].Name < d.RetypedVariables[j].Name
+	})
+	sort.Strings(d.AddedNodes)
+	sort.Strings(d.RemovedNodes)
+	return d
+}
+
+// MigrationFunc upgrades saved variables (such as the Contents of a
+// MapVariableStorage) in place.
+type MigrationFunc func(vars map[string]any) error
+
+// RenameVariable returns a MigrationFunc that renames a variable.
+func RenameVariable(from, to string) MigrationFunc {
+	return func(vars map[string]any) error {
+		if v, found := vars[from]; found {
+			delete(vars, from)
+			vars[to] = v
+		}
+		return nil
+	}
+}
+
+// RenameNode returns a MigrationFunc that renames the visit count variable
+// for a node, so that visited and visited_count keep working for the renamed
+// node.
+func RenameNode(from, to string) MigrationFunc {
+	return RenameVariable(VisitCountVariablePrefix+from, VisitCountVariablePrefix+to)
+}
+
+// RetypeVariable returns a MigrationFunc that converts a variable to a
+// different kind (using ConvertToBool, ConvertToFloat32, or ConvertToString).
+// Converting to NullKind deletes the variable.
+func RetypeVariable(name string, kind ValueKind) MigrationFunc {
+	return func(vars map[string]any) error {
+		v, found := vars[name]
+		if !found {
+			return nil
+		}
+		switch kind {
+		case NullKind:
+			delete(vars, name)
+		case BoolKind:
+			b, err := ConvertToBool(v)
+			if err != nil {
+				return fmt.Errorf("variable %q: %w", name, err)
+			}
+			vars[name] = b
+		case NumberKind:
+			f, err := ConvertToFloat32(v)
+			if err != nil {
+				return fmt.Errorf("variable %q: %w", name, err)
+			}
+			vars[name] = f
+		case StringKind:
+			vars[name] = ConvertToString(v)
+		default:
+			return fmt.Errorf("variable %q: %w: %v", name, ErrWrongType, kind)
+		}
+		return nil
+	}
+}
+
+// DeleteVariables returns a MigrationFunc that deletes variables.
+func DeleteVariables(names ...string) MigrationFunc {
+	return func(vars map[string]any) error {
+		for _, name := range names {
+			delete(vars, name)
+		}
+		return nil
+	}
+}
+
+// Migrations returns a MigrationFunc that applies each of fs in order,
+// stopping at the first error.
+func Migrations(fs ...MigrationFunc) MigrationFunc {
+	return func(vars map[string]any) error {
+		for _, f := range fs {
+			if err := f(vars); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+type migration struct {
+	to string
+	f  MigrationFunc
+}
+
+// Migrator is a registry of migrations between versions of saved variables.
+// Versions are arbitrary strings, for example, release numbers or the result
+// of SchemaFingerprint. The zero Migrator has no migrations registered.
+type Migrator struct {
+	mu         sync.RWMutex
+	migrations map[string]migration // from -> (to, f)
+}
+
+// Register registers a migration from one version to the next. There can be
+// only one migration from each version; registering another replaces it.
+func (m *Migrator) Register(from, to string, f MigrationFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.migrations == nil {
+		m.migrations = make(map[string]migration)
+	}
+	m.migrations[from] = migration{to: to, f: f}
+}
+
+// Migrate upgrades vars from one version to another, by applying the chain
+// of registered migrations starting at from. It does not modify vars;
+// instead it returns a migrated copy. If from and to are equal, the copy is
+// returned unchanged. If no chain of migrations leads from from to to,
+// Migrate returns ErrNoMigration.
+func (m *Migrator) Migrate(vars map[string]any, from, to string) (map[string]any, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// Find the chain first, so that nothing is run if there is no path.
+	var chain []MigrationFunc
+	for v := from; v != to; {
+		mig, found := m.migrations[v]
+		if !found || len(chain) == len(m.migrations) {
+			return nil, fmt.Errorf("%w from %q to %q", ErrNoMigration, from, to)
+		}
+		chain = append(chain, mig.f)
+		v = mig.to
+	}
+
+	out := copyMap(vars)
+	for i, f := range chain {
+		if err := f(out); err != nil {
+			return nil, fmt.Errorf("migration step %d: %w", i+1, err)
+		}
+	}
+	return out, nil
+}
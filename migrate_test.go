@@ -0,0 +1,118 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+
+	yarnpb "drjosh.dev/yarn/bytecode"
+	"github.com/google/go-cmp/cmp"
+)
+
+// declProgramV2 is declProgram after some edits: $gold is now a string,
+// $met_mae was renamed to $met_mae_at_well, $quest_target was removed, a
+// variable was added, and the Start node was renamed.
+func declProgramV2() *yarnpb.Program {
+	prog := declProgram()
+	prog.Nodes["Beginning"] = prog.Nodes["Start"]
+	delete(prog.Nodes, "Start")
+	prog.InitialValues = map[string]*yarnpb.Operand{
+		"$gold":            StringValue("10").Operand(),
+		"$met_mae_at_well": BoolValue(false).Operand(),
+		"$quest_start":     BoolValue(false).Operand(),
+		"$weather":         StringValue("sunny").Operand(),
+	}
+	return prog
+}
+
+func TestSchemaFingerprint(t *testing.T) {
+	v1, v2 := declProgram(), declProgramV2()
+	if SchemaFingerprint(v1) == SchemaFingerprint(v2) {
+		t.Error("SchemaFingerprint(v1) == SchemaFingerprint(v2), want different")
+	}
+
+	// Changing a default value doesn't change the fingerprint.
+	v1b := declProgram()
+	v1b.InitialValues["$gold"] = NumberValue(20).Operand()
+	if got, want := SchemaFingerprint(v1b), SchemaFingerprint(v1); got != want {
+		t.Errorf("SchemaFingerprint(v1b) = %q, want %q", got, want)
+	}
+}
+
+func TestDiffPrograms(t *testing.T) {
+	got := DiffPrograms(declProgram(), declProgramV2())
+	want := &ProgramDiff{
+		AddedVariables:   []string{"$met_mae_at_well", "$weather"},
+		RemovedVariables: []string{"$met_mae", "$quest_target"},
+		RetypedVariables: []RetypedVariable{{"$gold", NumberKind, StringKind}},
+		AddedNodes:       []string{"Beginning"},
+		RemovedNodes:     []string{"Start"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("DiffPrograms diff (-got +want):\n%s", diff)
+	}
+	if !DiffPrograms(declProgram(), declProgram()).Empty() {
+		t.Error("DiffPrograms(v1, v1).Empty() = false, want true")
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	v1, v2 := SchemaFingerprint(declProgram()), SchemaFingerprint(declProgramV2())
+	var m Migrator
+	m.Register(v1, "1.1", Migrations(
+		RenameVariable("$met_mae", "$met_mae_at_well"),
+		RenameNode("Start", "Beginning"),
+	))
+	m.Register("1.1", v2, Migrations(
+		RetypeVariable("$gold", StringKind),
+		DeleteVariables("$quest_target"),
+	))
+
+	saved := map[string]any{
+		"$gold":                            float32(3),
+		"$met_mae":                         true,
+		"$quest_target":                    "the well",
+		VisitCountVariablePrefix + "Start": float32(2),
+	}
+	got, err := m.Migrate(saved, v1, v2)
+	if err != nil {
+		t.Fatalf("Migrate(saved, v1, v2) = %v", err)
+	}
+	want := map[string]any{
+		"$gold":                                "3",
+		"$met_mae_at_well":                     true,
+		VisitCountVariablePrefix + "Beginning": float32(2),
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("migrated variables diff (-got +want):\n%s", diff)
+	}
+	if stale := StaleVariables(declProgramV2(), slices.Collect(maps.Keys(got))); len(stale) != 0 {
+		t.Errorf("StaleVariables(v2, migrated) = %v, want none", stale)
+	}
+	if _, found := saved["$met_mae_at_well"]; found {
+		t.Error("Migrate modified its input")
+	}
+
+	if _, err := m.Migrate(saved, v2, v1); !errors.Is(err, ErrNoMigration) {
+		t.Errorf("Migrate(saved, v2, v1) = %v, want %v", err, ErrNoMigration)
+	}
+	m.Register(v2, v1, DeleteVariables())
+	if _, err := m.Migrate(saved, v1, "nowhere"); !errors.Is(err, ErrNoMigration) {
+		t.Errorf("Migrate(saved, v1, nowhere) = %v, want %v", err, ErrNoMigration)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// NumericMode selects the precision of numbers in the VM.
+type NumericMode int
+
+const (
+	// NumericFloat32 is the default mode, matching Yarn Spinner, which uses
+	// single-precision (C# float) numbers. Integers are exact only up to
+	// 16777216 (2^24).
+	NumericFloat32 NumericMode = iota
+
+	// NumericFloat64 uses double-precision numbers. Integers are exact up to
+	// 2^53. In this mode:
+	//   - the operators and built-in functions compute in float64;
+	//   - number literals in the program, which the Yarn Spinner compiler
+	//     stores as float32, are widened by their shortest decimal form (so
+	//     0.1 is 0.1, not 0.100000001490116);
+	//   - numbers are stored in VariableStorage as float64 (but note that
+	//     FormatProtobuf, like the compiled program, can only hold float32);
+	//   - numbers passed to functions with interface{} or string parameters
+	//     are float64 or formatted as float64; and
+	//   - substitutions are formatted as float64 (see ConvertToString).
+	// Custom functions with float32 parameters or results still receive and
+	// return float32.
+	NumericFloat64
+)
+
+func (m NumericMode) String() string {
+	switch m {
+	case NumericFloat32:
+		return "float32"
+	case NumericFloat64:
+		return "float64"
+	}
+	return fmt.Sprintf("(invalid NumericMode %d)", m)
+}
+
+// widenFloat32 converts a float32 to the float64 with the same shortest
+// decimal representation. For example, float32(0.1) is actually
+// 0.100000001490116..., but widenFloat32 returns float64(0.1).
+func widenFloat32(f float32) float64 {
+	// ParseFloat accepts everything FormatFloat produces (including "+Inf"
+	// and "NaN"), so there is no error to handle.
+	w, _ := strconv.ParseFloat(strconv.FormatFloat(float64(f), 'g', -1, 32), 64)
+	return w
+}
@@ -0,0 +1,172 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"testing"
+
+	yarnpb "drjosh.dev/yarn/bytecode"
+	"github.com/google/go-cmp/cmp"
+)
+
+// lineRecorder records the lines delivered to it.
+type lineRecorder struct {
+	FakeDialogueHandler
+	lines []Line
+}
+
+func (r *lineRecorder) Line(line Line) error {
+	r.lines = append(r.lines, line)
+	return nil
+}
+
+// shopProgram adds $price to $gold, and then runs a line with the new total
+// as a substitution.
+func shopProgram() *yarnpb.Program {
+	node := &yarnpb.Node{
+		Name: "Start",
+		Instructions: []*yarnpb.Instruction{
+			{
+				Opcode:   yarnpb.Instruction_PUSH_VARIABLE,
+				Operands: []*yarnpb.Operand{StringValue("$gold").Operand()},
+			},
+			{
+				Opcode:   yarnpb.Instruction_PUSH_VARIABLE,
+				Operands: []*yarnpb.Operand{StringValue("$price").Operand()},
+			},
+			{
+				Opcode:   yarnpb.Instruction_PUSH_FLOAT,
+				Operands: []*yarnpb.Operand{NumberValue(2).Operand()},
+			},
+			{
+				Opcode:   yarnpb.Instruction_CALL_FUNC,
+				Operands: []*yarnpb.Operand{StringValue("Number.Add").Operand()},
+			},
+			{
+				Opcode:   yarnpb.Instruction_STORE_VARIABLE,
+				Operands: []*yarnpb.Operand{StringValue("$gold").Operand()},
+			},
+			{
+				Opcode: yarnpb.Instruction_RUN_LINE,
+				Operands: []*yarnpb.Operand{
+					StringValue("line:1").Operand(),
+					NumberValue(1).Operand(),
+				},
+			},
+			{Opcode: yarnpb.Instruction_STOP},
+		},
+	}
+	return &yarnpb.Program{
+		Nodes: map[string]*yarnpb.Node{"Start": node},
+		InitialValues: map[string]*yarnpb.Operand{
+			"$price": NumberValue(0.1).Operand(),
+		},
+	}
+}
+
+func TestNumericMode(t *testing.T) {
+	tests := []struct {
+		mode     NumericMode
+		gold     any
+		wantGold any
+		wantLine string
+	}{
+		{NumericFloat32, float32(16777216), float32(16777216), "16777216"},
+		{NumericFloat64, float32(16777216), float64(16777216.1), "16777216.1"},
+		{NumericFloat64, float64(123456789012), float64(123456789012.1), "123456789012.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.mode.String(), func(t *testing.T) {
+			vars := NewMapVariableStorageFromMap(map[string]any{"$gold": test.gold})
+			handler := &lineRecorder{}
+			vm := &VirtualMachine{
+				Program:     shopProgram(),
+				Handler:     handler,
+				Vars:        vars,
+				NumericMode: test.mode,
+			}
+			if err := vm.Run("Start"); err != nil {
+				t.Fatalf("vm.Run(Start) = %v", err)
+			}
+			got, _ := vars.GetValue("$gold")
+			if got != test.wantGold {
+				t.Errorf("$gold = %T(%v), want %T(%v)", got, got, test.wantGold, test.wantGold)
+			}
+			wantValue, err := ValueOf(test.wantGold)
+			if err != nil {
+				t.Fatalf("ValueOf(%v) = %v", test.wantGold, err)
+			}
+			want := []Line{{
+				ID:            "line:1",
+				Substitutions: []string{test.wantLine},
+				Values:        []Value{wantValue},
+			}}
+			if diff := cmp.Diff(handler.lines, want); diff != "" {
+				t.Errorf("lines diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNumericModeLiterals(t *testing.T) {
+	// Literals are float32 in the program, but are widened in float64 mode.
+	tenth32, fifth32 := float32(0.1), float32(0.2)
+	tenth64, fifth64 := 0.1, 0.2
+	tests := []struct {
+		mode NumericMode
+		want any
+	}{
+		{NumericFloat32, tenth32 + fifth32},
+		{NumericFloat64, tenth64 + fifth64},
+	}
+	for _, test := range tests {
+		vars := NewMapVariableStorage()
+		vm := &VirtualMachine{
+			Program:     callProgram("Add", NumberValue(0.1), NumberValue(0.2)),
+			Handler:     FakeDialogueHandler{},
+			Vars:        vars,
+			NumericMode: test.mode,
+		}
+		if err := vm.Run("Start"); err != nil {
+			t.Fatalf("%v: vm.Run(Start) = %v", test.mode, err)
+		}
+		if got, _ := vars.GetValue("$result"); got != test.want {
+			t.Errorf("%v: $result = %T(%v), want %T(%v)", test.mode, got, got, test.want, test.want)
+		}
+	}
+}
+
+func TestNumberValuePrecision(t *testing.T) {
+	third := 1.0 / 3
+	tests := []struct {
+		v       Value
+		wantStr string
+		wantAny any
+	}{
+		{NumberValue(third), "0.33333334", float32(third)},
+		{NumberValue64(third), "0.3333333333333333", third},
+	}
+	for _, test := range tests {
+		if got := test.v.String(); got != test.wantStr {
+			t.Errorf("%#v.String() = %q, want %q", test.v, got, test.wantStr)
+		}
+		if got := test.v.Interface(); got != test.wantAny {
+			t.Errorf("%#v.Interface() = %T(%v), want %T(%v)", test.v, got, got, test.wantAny, test.wantAny)
+		}
+	}
+	if !NumberValue(third).Equal(NumberValue64(third)) {
+		t.Error("NumberValue and NumberValue64 of the same number are not Equal")
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+var (
+	_ TypedVariableStorage     = &ObservableVariableStorage{}
+	_ FlushableVariableStorage = &ObservableVariableStorage{}
+	_ FallibleVariableStorage  = &ObservableVariableStorage{}
+)
+
+// VariableChangeFunc is called when a variable changes. old and new are nil
+// if the variable was not previously set, or has been deleted, respectively.
+type VariableChangeFunc func(name string, old, new any)
+
+// VariableChange describes a change to a variable, for delivery on a channel
+// (see SendChanges).
+type VariableChange struct {
+	Name     string
+	Old, New any
+}
+
+// SendChanges returns a VariableChangeFunc that sends each change to ch, in
+// the order the changes were made. Sending never blocks the writer (usually
+// the VM), and never drops changes: changes that ch is not ready to receive
+// are queued, and a goroutine sends them to ch as it becomes ready. The queue
+// has no limit, so ch should be drained for as long as the storage is in use.
+func SendChanges(ch chan<- VariableChange) VariableChangeFunc {
+	var (
+		mu      sync.Mutex
+		queue   []VariableChange
+		sending bool // whether a goroutine is sending the queue
+	)
+	send := func() {
+		for {
+			mu.Lock()
+			if len(queue) == 0 {
+				sending = false
+				mu.Unlock()
+				return
+			}
+			c := queue[0]
+			queue[0] = VariableChange{}
+			queue = queue[1:]
+			mu.Unlock()
+			ch <- c
+		}
+	}
+	return func(name string, old, new any) {
+		c := VariableChange{Name: name, Old: old, New: new}
+		mu.Lock()
+		defer mu.Unlock()
+		if !sending {
+			select {
+			case ch <- c:
+				return
+			default:
+			}
+			sending = true
+			go send()
+		}
+		queue = append(queue, c)
+	}
+}
+
+type subscription struct {
+	pattern string
+	f       VariableChangeFunc
+}
+
+// ObservableVariableStorage wraps another VariableStorage, and notifies
+// subscribers when variables are set or deleted. It can wrap any
+// VariableStorage. Setting a variable to the value it already has (compared
+// with Value.Equal) is not a change, and subscribers are not notified.
+//
+// Subscribers are called synchronously, after the change has been made, in
+// the order they subscribed. They may read from the storage, but should not
+// write to it (to avoid infinite loops).
+type ObservableVariableStorage struct {
+	base VariableStorage
+
+	mu     sync.RWMutex
+	nextID int
+	subs   map[int]subscription
+}
+
+// NewObservableVariableStorage returns a new ObservableVariableStorage
+// wrapping base.
+func NewObservableVariableStorage(base VariableStorage) *ObservableVariableStorage {
+	return &ObservableVariableStorage{
+		base: base,
+		subs: make(map[int]subscription),
+	}
+}
+
+// Base returns the wrapped storage.
+func (o *ObservableVariableStorage) Base() VariableStorage { return o.base }
+
+// Subscribe calls f whenever a variable with a name matching pattern is set
+// or deleted. Patterns use the syntax of path.Match, for example, "$quest_*"
+// matches all variables starting with "$quest_". The returned func cancels
+// the subscription.
+func (o *ObservableVariableStorage) Subscribe(pattern string, f VariableChangeFunc) (cancel func(), err error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("pattern %q: %w", pattern, err)
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	id := o.nextID
+	o.nextID++
+	o.subs[id] = subscription{pattern: pattern, f: f}
+	return func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		delete(o.subs, id)
+	}, nil
+}
+
+// Watch evaluates expr now, and again whenever a variable matching pattern
+// changes. Whenever the result differs from the previous result, f is called
+// with the previous and new results. expr is passed the storage to read
+// variables from. For example, to be notified when the player has met two
+// characters:
+//
+//	vars.Watch("$met_*", func(v VariableStorage) any {
+//		mae, _ := v.GetValue("$met_mae")
+//		sam, _ := v.GetValue("$met_sam")
+//		return mae == true && sam == true
+//	}, func(old, new any) { ... })
+//
+// The returned func cancels the watch.
+func (o *ObservableVariableStorage) Watch(pattern string, expr func(VariableStorage) any, f func(old, new any)) (cancel func(), err error) {
+	var mu sync.Mutex
+	last := expr(o)
+	return o.Subscribe(pattern, func(string, any, any) {
+		mu.Lock()
+		defer mu.Unlock()
+		next := expr(o)
+		if reflect.DeepEqual(last, next) {
+			return
+		}
+		prev := last
+		last = next
+		f(prev, next)
+	})
+}
+
+// notify calls the subscribers matching name.
+func (o *ObservableVariableStorage) notify(name string, old, new any) {
+	o.mu.RLock()
+	ids := make([]int, 0, len(o.subs))
+	for id, s := range o.subs {
+		if ok, _ := path.Match(s.pattern, name); ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	fs := make([]VariableChangeFunc, len(ids))
+	for i, id := range ids {
+		fs[i] = o.subs[id].f
+	}
+	o.mu.RUnlock()
+
+	for _, f := range fs {
+		f(name, old, new)
+	}
+}
+
+// GetValue fetches a value from the wrapped storage.
+func (o *ObservableVariableStorage) GetValue(name string) (value any, found bool) {
+	return o.base.GetValue(name)
+}
+
+// SetValue sets a value in the wrapped storage, and notifies subscribers.
+func (o *ObservableVariableStorage) SetValue(name string, value any) {
+	old, found := o.base.GetValue(name)
+	o.base.SetValue(name, value)
+	if found && valueOrOpaque(old).Equal(valueOrOpaque(value)) {
+		return
+	}
+	o.notify(name, old, value)
+}
+
+// GetTypedValue fetches a value from the wrapped storage, converting it to a
+// Value if the wrapped storage is not a TypedVariableStorage.
+func (o *ObservableVariableStorage) GetTypedValue(name string) (value Value, found bool) {
+	if tv, ok := o.base.(TypedVariableStorage); ok {
+		return tv.GetTypedValue(name)
+	}
+	x, found := o.base.GetValue(name)
+	if !found {
+		return Value{}, false
+	}
+	return valueOrOpaque(x), true
+}
+
+// SetTypedValue sets a value in the wrapped storage, and notifies
+// subscribers. Subscribers receive values as returned by Value.Interface.
+func (o *ObservableVariableStorage) SetTypedValue(name string, value Value) {
+	tv, ok := o.base.(TypedVariableStorage)
+	if !ok {
+		o.SetValue(name, value.Interface())
+		return
+	}
+	var old any
+	v, found := tv.GetTypedValue(name)
+	if found {
+		old = v.Interface()
+	}
+	tv.SetTypedValue(name, value)
+	if found && v.Equal(value) {
+		return
+	}
+	o.notify(name, old, value.Interface())
+}
+
+// Delete deletes values from the wrapped storage, if it has a Delete method,
+// and notifies subscribers of each deleted variable that was set.
+func (o *ObservableVariableStorage) Delete(names ...string) {
+	del, ok := o.base.(deletableVariableStorage)
+	if !ok {
+		return
+	}
+	olds := make([]any, len(names))
+	found := make([]bool, len(names))
+	for i, name := range names {
+		olds[i], found[i] = o.base.GetValue(name)
+	}
+	del.Delete(names...)
+	for i, name := range names {
+		if found[i] {
+			o.notify(name, olds[i], nil)
+		}
+	}
+}
+
+// Flush flushes the wrapped storage, if it is a FlushableVariableStorage.
+func (o *ObservableVariableStorage) Flush() error {
+	if fv, ok := o.base.(FlushableVariableStorage); ok {
+		return fv.Flush()
+	}
+	return nil
+}
+
+// Err returns the error from the wrapped storage, if it is a
+// FallibleVariableStorage.
+func (o *ObservableVariableStorage) Err() error {
+	if fv, ok := o.base.(FallibleVariableStorage); ok {
+		return fv.Err()
+	}
+	return nil
+}
+
+// IsReadOnly reports whether the wrapped storage has a read-only variable
+// called name (see ComputedVariableStorage).
+func (o *ObservableVariableStorage) IsReadOnly(name string) bool {
+	ro, ok := o.base.(readOnlyChecker)
+	return ok && ro.IsReadOnly(name)
+}
@@ -0,0 +1,137 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestObservableVariableStorageSubscribe(t *testing.T) {
+	o := NewObservableVariableStorage(NewMapVariableStorage())
+	var got []VariableChange
+	cancel, err := o.Subscribe("$quest_*", func(name string, old, new any) {
+		got = append(got, VariableChange{name, old, new})
+	})
+	if err != nil {
+		t.Fatalf("Subscribe = %v", err)
+	}
+	o.SetValue("$quest_start", true)
+	o.SetValue("$quest_start", true) // unchanged
+	o.SetValue("$met_mae", true)     // not matched
+	o.SetTypedValue("$quest_start", BoolValue(false))
+	o.Delete("$quest_start", "$quest_missing")
+	cancel()
+	o.SetValue("$quest_end", true) // after cancel
+
+	want := []VariableChange{
+		{"$quest_start", nil, true},
+		{"$quest_start", true, false},
+		{"$quest_start", false, nil},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("changes diff (-got +want):\n%s", diff)
+	}
+
+	if _, err := o.Subscribe("[", func(string, any, any) {}); err == nil {
+		t.Error("Subscribe([) error = nil, want error")
+	}
+}
+
+func TestObservableVariableStorageChannel(t *testing.T) {
+	o := NewObservableVariableStorage(NewTypedMapVariableStorage())
+	ch := make(chan VariableChange, 1)
+	if _, err := o.Subscribe("$met_*", SendChanges(ch)); err != nil {
+		t.Fatalf("Subscribe = %v", err)
+	}
+	o.SetTypedValue("$met_mae", BoolValue(true))
+	o.SetTypedValue("$met_mae", BoolValue(true))  // unchanged
+	o.SetTypedValue("$met_mae", BoolValue(false)) // queued: ch is full
+	o.SetTypedValue("$met_sam", BoolValue(true))  // queued
+	want := []VariableChange{
+		{"$met_mae", nil, true},
+		{"$met_mae", true, false},
+		{"$met_sam", nil, true},
+	}
+	for _, w := range want {
+		if diff := cmp.Diff(<-ch, w); diff != "" {
+			t.Errorf("change diff (-got +want):\n%s", diff)
+		}
+	}
+	select {
+	case c := <-ch:
+		t.Errorf("unexpected change %v", c)
+	default:
+	}
+}
+
+func TestSendChangesUnbufferedInOrder(t *testing.T) {
+	ch := make(chan VariableChange)
+	f := SendChanges(ch)
+	const n = 100
+	for i := range n {
+		f("$x", i, i+1) // never blocks, though nobody is receiving yet
+	}
+	for i := range n {
+		if got, want := <-ch, (VariableChange{"$x", i, i + 1}); got != want {
+			t.Fatalf("change %d = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestObservableVariableStorageWatch(t *testing.T) {
+	o := NewObservableVariableStorage(NewMapVariableStorage())
+	var got [][2]any
+	_, err := o.Watch("$met_*", func(v VariableStorage) any {
+		mae, _ := v.GetValue("$met_mae")
+		sam, _ := v.GetValue("$met_sam")
+		return mae == true && sam == true
+	}, func(old, new any) {
+		got = append(got, [2]any{old, new})
+	})
+	if err != nil {
+		t.Fatalf("Watch = %v", err)
+	}
+	o.SetValue("$met_mae", true)
+	o.SetValue("$met_sam", true)
+	o.SetValue("$met_sam", true) // no change to result
+	o.SetValue("$met_mae", false)
+
+	want := [][2]any{{false, true}, {true, false}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("watch results diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestObservableVariableStorageVM(t *testing.T) {
+	o := NewObservableVariableStorage(NewMapVariableStorage())
+	var got []any
+	if _, err := o.Subscribe("$x", func(_ string, _, new any) { got = append(got, new) }); err != nil {
+		t.Fatalf("Subscribe = %v", err)
+	}
+	vm := &VirtualMachine{
+		Program: loopProgram(3),
+		Handler: FakeDialogueHandler{},
+		Vars:    o,
+	}
+	if err := vm.Run("Start"); err != nil {
+		t.Fatalf("vm.Run(Start) = %v", err)
+	}
+	want := []any{float32(0), float32(1), float32(2)}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("changes diff (-got +want):\n%s", diff)
+	}
+}
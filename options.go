@@ -0,0 +1,109 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"fmt"
+	"strings"
+
+	yarnpb "drjosh.dev/yarn/bytecode"
+)
+
+// OptionPolicy is a set of flags controlling how the VM handles options that
+// are not available (Option.IsAvailable is false).
+type OptionPolicy uint
+
+const (
+	// RejectUnavailableOptions makes the VM return ErrOptionUnavailable if
+	// the handler selects an unavailable option.
+	RejectUnavailableOptions OptionPolicy = 1 << iota
+
+	// FilterUnavailableOptions makes the VM deliver only the available
+	// options to the handler. The delivered options are renumbered, so that
+	// their IDs are still 0, 1, 2, ... in order.
+	FilterUnavailableOptions
+
+	// SkipUnavailableOptions makes the VM continue after the end of the
+	// options block if none of the options are available, instead of
+	// delivering them to the handler. Yarn Spinner does this by default, but
+	// this VM only does it when this flag is set: without it, the options are
+	// delivered as usual, or with FilterUnavailableOptions, the VM returns
+	// ErrNoOptions. The end of the block is found using the group_end label
+	// that the compiler generates for it.
+	SkipUnavailableOptions
+)
+
+// availableOptions returns the available options, renumbered.
+func availableOptions(opts []Option) []Option {
+	avail := make([]Option, 0, len(opts))
+	for _, opt := range opts {
+		if !opt.IsAvailable {
+			continue
+		}
+		opt.ID = len(avail)
+		avail = append(avail, opt)
+	}
+	return avail
+}
+
+// anyAvailable reports whether any of the options are available.
+func anyAvailable(opts []Option) bool {
+	for _, opt := range opts {
+		if opt.IsAvailable {
+			return true
+		}
+	}
+	return false
+}
+
+// isGroupEndLabel reports whether the label is one the compiler generates for
+// the end of an options block ("L" followed by a number, then "group_end").
+func isGroupEndLabel(label string) bool {
+	rest, ok := strings.CutPrefix(label, "L")
+	if !ok {
+		return false
+	}
+	rest = strings.TrimLeft(rest, "0123456789")
+	return rest == "group_end" && len(rest) < len(label)-1
+}
+
+// optionsBlockEnd finds the end of the options block shown by the SHOW_OPTIONS
+// instruction at pc, which is the instruction labelled with the block's
+// group_end label. Option bodies can contain other options blocks (with their
+// own group_end labels), so this counts the nested SHOW_OPTIONS instructions
+// to find the matching label. The result is the pc of the labelled
+// instruction (a POP).
+func optionsBlockEnd(node *yarnpb.Node, pc int) (int, error) {
+	ends := make(map[int]bool)
+	for label, target := range node.Labels {
+		if isGroupEndLabel(label) {
+			ends[int(target)] = true
+		}
+	}
+	depth := 0
+	insts := node.Instructions
+	for i := pc + 1; i < len(insts); i++ {
+		if ends[i] {
+			if depth == 0 {
+				return i, nil
+			}
+			depth--
+		}
+		if insts[i].Opcode == yarnpb.Instruction_SHOW_OPTIONS {
+			depth++
+		}
+	}
+	return 0, fmt.Errorf("couldn't find the group_end label of the options block at %s %06d", node.Name, pc)
+}
@@ -0,0 +1,234 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"errors"
+	"testing"
+
+	yarnpb "drjosh.dev/yarn/bytecode"
+	"github.com/google/go-cmp/cmp"
+)
+
+// optionPicker records lines and options, and always picks the same option.
+type optionPicker struct {
+	lineRecorder
+	pick    int
+	options [][]Option
+}
+
+func (p *optionPicker) Options(opts []Option) (int, error) {
+	p.options = append(p.options, opts)
+	return p.pick, nil
+}
+
+// optionsProgram has an options block with two options (a and b), with the
+// given availability. Option a contains another options block.
+func optionsProgram(availA, availB bool) *yarnpb.Program {
+	str := func(s string) *yarnpb.Operand { return StringValue(s).Operand() }
+	num := func(n float64) *yarnpb.Operand { return NumberValue(n).Operand() }
+	boolean := func(b bool) *yarnpb.Operand { return BoolValue(b).Operand() }
+	node := &yarnpb.Node{
+		Name: "Start",
+		Instructions: []*yarnpb.Instruction{
+			{Opcode: yarnpb.Instruction_PUSH_BOOL, Operands: []*yarnpb.Operand{boolean(availA)}},
+			{Opcode: yarnpb.Instruction_ADD_OPTION, Operands: []*yarnpb.Operand{str("line:a"), str("La"), num(0), boolean(true)}},
+			{Opcode: yarnpb.Instruction_PUSH_BOOL, Operands: []*yarnpb.Operand{boolean(availB)}},
+			{Opcode: yarnpb.Instruction_ADD_OPTION, Operands: []*yarnpb.Operand{str("line:b"), str("Lb"), num(0), boolean(true)}},
+			{Opcode: yarnpb.Instruction_SHOW_OPTIONS},
+			{Opcode: yarnpb.Instruction_JUMP},
+			// La: 6
+			{Opcode: yarnpb.Instruction_RUN_LINE, Operands: []*yarnpb.Operand{str("line:in_a")}},
+			{Opcode: yarnpb.Instruction_ADD_OPTION, Operands: []*yarnpb.Operand{str("line:a1"), str("La1"), num(0), boolean(false)}},
+			{Opcode: yarnpb.Instruction_SHOW_OPTIONS},
+			{Opcode: yarnpb.Instruction_JUMP},
+			// La1: 10
+			{Opcode: yarnpb.Instruction_JUMP_TO, Operands: []*yarnpb.Operand{str("L1group_end")}},
+			// L1group_end: 11
+			{Opcode: yarnpb.Instruction_POP},
+			{Opcode: yarnpb.Instruction_JUMP_TO, Operands: []*yarnpb.Operand{str("L0group_end")}},
+			// Lb: 13
+			{Opcode: yarnpb.Instruction_RUN_LINE, Operands: []*yarnpb.Operand{str("line:in_b")}},
+			{Opcode: yarnpb.Instruction_JUMP_TO, Operands: []*yarnpb.Operand{str("L0group_end")}},
+			// L0group_end: 15
+			{Opcode: yarnpb.Instruction_POP},
+			{Opcode: yarnpb.Instruction_RUN_LINE, Operands: []*yarnpb.Operand{str("line:after")}},
+			{Opcode: yarnpb.Instruction_STOP},
+		},
+		Labels: map[string]int32{
+			"La":          6,
+			"La1":         10,
+			"L1group_end": 11,
+			"Lb":          13,
+			"L0group_end": 15,
+		},
+	}
+	return &yarnpb.Program{Nodes: map[string]*yarnpb.Node{"Start": node}}
+}
+
+func TestOptionPolicy(t *testing.T) {
+	tests := []struct {
+		name           string
+		policy         OptionPolicy
+		availA, availB bool
+		pick           int
+		wantOptions    [][]Option
+		wantLines      []string
+		wantErr        error
+	}{
+		{
+			name:   "default delivers and allows unavailable",
+			availA: false,
+			availB: true,
+			pick:   0,
+			wantOptions: [][]Option{
+				{
+					{ID: 0, Line: Line{ID: "line:a"}, DestinationNode: "La"},
+					{ID: 1, Line: Line{ID: "line:b"}, DestinationNode: "Lb", IsAvailable: true},
+				},
+				{
+					{ID: 0, Line: Line{ID: "line:a1"}, DestinationNode: "La1", IsAvailable: true},
+				},
+			},
+			wantLines: []string{"line:in_a", "line:after"},
+		},
+		{
+			name:   "reject unavailable",
+			policy: RejectUnavailableOptions,
+			availA: false,
+			availB: true,
+			pick:   0,
+			wantOptions: [][]Option{{
+				{ID: 0, Line: Line{ID: "line:a"}, DestinationNode: "La"},
+				{ID: 1, Line: Line{ID: "line:b"}, DestinationNode: "Lb", IsAvailable: true},
+			}},
+			wantErr: ErrOptionUnavailable,
+		},
+		{
+			name:   "reject allows available",
+			policy: RejectUnavailableOptions,
+			availA: false,
+			availB: true,
+			pick:   1,
+			wantOptions: [][]Option{{
+				{ID: 0, Line: Line{ID: "line:a"}, DestinationNode: "La"},
+				{ID: 1, Line: Line{ID: "line:b"}, DestinationNode: "Lb", IsAvailable: true},
+			}},
+			wantLines: []string{"line:in_b", "line:after"},
+		},
+		{
+			name:   "filter renumbers",
+			policy: FilterUnavailableOptions,
+			availA: false,
+			availB: true,
+			pick:   0,
+			wantOptions: [][]Option{{
+				{ID: 0, Line: Line{ID: "line:b"}, DestinationNode: "Lb", IsAvailable: true},
+			}},
+			wantLines: []string{"line:in_b", "line:after"},
+		},
+		{
+			name:    "filter with none available",
+			policy:  FilterUnavailableOptions,
+			wantErr: ErrNoOptions,
+		},
+		{
+			name:      "skip",
+			policy:    SkipUnavailableOptions,
+			wantLines: []string{"line:after"},
+		},
+		{
+			name:      "filter and skip",
+			policy:    FilterUnavailableOptions | SkipUnavailableOptions,
+			wantLines: []string{"line:after"},
+		},
+		{
+			name:   "skip with some available",
+			policy: SkipUnavailableOptions,
+			availA: true,
+			pick:   0,
+			wantOptions: [][]Option{
+				{
+					{ID: 0, Line: Line{ID: "line:a"}, DestinationNode: "La", IsAvailable: true},
+					{ID: 1, Line: Line{ID: "line:b"}, DestinationNode: "Lb"},
+				},
+				{
+					{ID: 0, Line: Line{ID: "line:a1"}, DestinationNode: "La1", IsAvailable: true},
+				},
+			},
+			wantLines: []string{"line:in_a", "line:after"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := &optionPicker{pick: test.pick}
+			vm := &VirtualMachine{
+				Program:      optionsProgram(test.availA, test.availB),
+				Handler:      handler,
+				Vars:         NewMapVariableStorage(),
+				OptionPolicy: test.policy,
+			}
+			if err := vm.Run("Start"); !errors.Is(err, test.wantErr) {
+				t.Errorf("vm.Run(Start) = %v, want %v", err, test.wantErr)
+			}
+			if diff := cmp.Diff(handler.options, test.wantOptions); diff != "" {
+				t.Errorf("options diff (-got +want):\n%s", diff)
+			}
+			var lines []string
+			for _, l := range handler.lines {
+				lines = append(lines, l.ID)
+			}
+			if diff := cmp.Diff(lines, test.wantLines); diff != "" {
+				t.Errorf("lines diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestOptionsBlockEndCompiled(t *testing.T) {
+	prog, _, err := LoadFiles("testdata/ShortcutOptions.yarnc", "en")
+	if err != nil {
+		t.Fatalf("LoadFiles = %v", err)
+	}
+	node := prog.Nodes["Start"]
+	// SHOW_OPTIONS pc -> group_end label pc. The block at 4 contains the
+	// block at 17.
+	tests := map[int]int{4: 35, 17: 29, 39: 43, 67: 71}
+	for pc, want := range tests {
+		got, err := optionsBlockEnd(node, pc)
+		if err != nil || got != want {
+			t.Errorf("optionsBlockEnd(Start, %d) = %d, %v, want %d, nil", pc, got, err, want)
+		}
+	}
+}
+
+func TestOptionsBlockEndMissingLabel(t *testing.T) {
+	node := optionsProgram(false, false).Nodes["Start"]
+	delete(node.Labels, "L0group_end")
+	node.Labels["Lend"] = 15
+	if got, err := optionsBlockEnd(node, 4); err == nil {
+		t.Errorf("optionsBlockEnd(Start, 4) = %d, nil, want error", got)
+	}
+
+	vm := &VirtualMachine{
+		Program:      &yarnpb.Program{Nodes: map[string]*yarnpb.Node{"Start": node}},
+		Handler:      &optionPicker{},
+		Vars:         NewMapVariableStorage(),
+		OptionPolicy: SkipUnavailableOptions,
+	}
+	if err := vm.Run("Start"); err == nil {
+		t.Error("vm.Run(Start) = nil, want error")
+	}
+}
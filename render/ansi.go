@@ -0,0 +1,100 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"strings"
+
+	"drjosh.dev/yarn"
+)
+
+// ANSIReset is the ANSI escape sequence that resets all styles.
+const ANSIReset = "\033[0m"
+
+// DefaultANSIStyles maps common style tags to ANSI escape sequences. See
+// https://en.wikipedia.org/wiki/ANSI_escape_code.
+var DefaultANSIStyles = map[string]string{
+	"b":         "\033[1m",
+	"bold":      "\033[1m",
+	"lowint":    "\033[2m",
+	"i":         "\033[3m",
+	"italic":    "\033[3m",
+	"u":         "\033[4m",
+	"underline": "\033[4m",
+	"blink":     "\033[5m",
+	"reverse":   "\033[7m",
+	"invisible": "\033[8m",
+	"s":         "\033[9m",
+	"strike":    "\033[9m",
+	"red":       "\033[31m",
+	"green":     "\033[32m",
+	"yellow":    "\033[33m",
+	"blue":      "\033[34m",
+	"purple":    "\033[35m",
+	"cyan":      "\033[36m",
+	"gray":      "\033[37m",
+	"grey":      "\033[37m",
+	"white":     "\033[97m",
+}
+
+// ANSI renders attributed strings for terminals, using ANSI escape sequences
+// to apply styles. When an attribute ends, all styles are reset, and the
+// styles of the attributes that are still open are restored.
+type ANSI struct {
+	// Styles maps attribute names to escape sequences. Attributes not in
+	// the map are not rendered. If Styles is nil, DefaultANSIStyles is used.
+	Styles map[string]string
+}
+
+func (r *ANSI) styles() map[string]string {
+	if r.Styles == nil {
+		return DefaultANSIStyles
+	}
+	return r.Styles
+}
+
+// Render renders s with ANSI escape sequences.
+func (r *ANSI) Render(s *yarn.AttributedString) string {
+	styles := r.styles()
+	var (
+		sb     strings.Builder
+		active []*yarn.Attribute
+		reset  bool // an attribute closed since the last text
+	)
+	walk(s, func(a *yarn.Attribute) bool {
+		return styles[a.Name] != ""
+	}, func(text string) {
+		if reset {
+			sb.WriteString(ANSIReset)
+			for _, a := range active {
+				sb.WriteString(styles[a.Name])
+			}
+			reset = false
+		}
+		sb.WriteString(text)
+	}, func(a *yarn.Attribute) {
+		active = append(active, a)
+		if !reset {
+			sb.WriteString(styles[a.Name])
+		}
+	}, func(a *yarn.Attribute) {
+		active = active[:len(active)-1]
+		reset = true
+	})
+	if reset {
+		sb.WriteString(ANSIReset)
+	}
+	return sb.String()
+}
@@ -0,0 +1,114 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"strings"
+
+	"drjosh.dev/yarn"
+)
+
+// DefaultBBCodeTags maps common style tags to BBCode tags.
+var DefaultBBCodeTags = map[string]string{
+	"b":         "b",
+	"bold":      "b",
+	"i":         "i",
+	"italic":    "i",
+	"u":         "u",
+	"underline": "u",
+	"s":         "s",
+	"strike":    "s",
+	"red":       "color=red",
+	"green":     "color=green",
+	"yellow":    "color=yellow",
+	"blue":      "color=blue",
+	"purple":    "color=purple",
+	"cyan":      "color=cyan",
+	"gray":      "color=gray",
+	"grey":      "color=gray",
+	"white":     "color=white",
+}
+
+// EscapeGodot escapes square brackets in text for Godot's RichTextLabel.
+var EscapeGodot = strings.NewReplacer("[", "[lb]", "]", "[rb]").Replace
+
+// BBCode renders attributed strings as BBCode, for engines (such as Godot)
+// and forums that support it. Tags are always properly nested.
+type BBCode struct {
+	// Tags maps attribute names to the contents of BBCode opening tags,
+	// for example "b" or "color=red". The closing tag uses the first word
+	// ([/b], [/color]). If Tags is nil, DefaultBBCodeTags is used.
+	Tags map[string]string
+
+	// PassThrough renders attributes not in Tags as BBCode tags with the
+	// same name and properties (for example, [wave amp=50]). Otherwise they
+	// are not rendered. The implicit "character" and "nomarkup" attributes
+	// are never passed through, but can be rendered by adding them to Tags.
+	PassThrough bool
+
+	// Escape, if not nil, is applied to text (for example, EscapeGodot).
+	Escape func(string) string
+}
+
+// tag returns the contents of the opening tag for an attribute, if it is
+// rendered.
+func (r *BBCode) tag(a *yarn.Attribute) (string, bool) {
+	tags := r.Tags
+	if tags == nil {
+		tags = DefaultBBCodeTags
+	}
+	if t, ok := tags[a.Name]; ok {
+		return t, t != ""
+	}
+	if !r.PassThrough || a.Name == "character" || a.Name == "nomarkup" {
+		return "", false
+	}
+	var sb strings.Builder
+	sb.WriteString(a.Name)
+	if v, ok := a.Props[a.Name]; ok {
+		// Shorthand, e.g. [wave=2]
+		sb.WriteString("=" + propString(v))
+	}
+	for _, k := range sortedProps(a) {
+		if k == a.Name {
+			continue
+		}
+		sb.WriteString(" " + k + "=" + propString(a.Props[k]))
+	}
+	return sb.String(), true
+}
+
+// Render renders s as BBCode.
+func (r *BBCode) Render(s *yarn.AttributedString) string {
+	var sb strings.Builder
+	walk(s, func(a *yarn.Attribute) bool {
+		_, ok := r.tag(a)
+		return ok
+	}, func(text string) {
+		if r.Escape != nil {
+			text = r.Escape(text)
+		}
+		sb.WriteString(text)
+	}, func(a *yarn.Attribute) {
+		t, _ := r.tag(a)
+		sb.WriteString("[" + t + "]")
+	}, func(a *yarn.Attribute) {
+		t, _ := r.tag(a)
+		name, _, _ := strings.Cut(t, " ")
+		name, _, _ = strings.Cut(name, "=")
+		sb.WriteString("[/" + name + "]")
+	})
+	return sb.String()
+}
@@ -0,0 +1,129 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"html"
+	"strings"
+
+	"drjosh.dev/yarn"
+)
+
+// HTMLElement describes the HTML element used for an attribute.
+type HTMLElement struct {
+	Tag   string // for example, "strong" or "span"
+	Class string // optional class attribute
+}
+
+// DefaultHTMLElements maps common style tags to HTML elements.
+var DefaultHTMLElements = map[string]HTMLElement{
+	"b":         {Tag: "b"},
+	"bold":      {Tag: "b"},
+	"i":         {Tag: "i"},
+	"italic":    {Tag: "i"},
+	"u":         {Tag: "u"},
+	"underline": {Tag: "u"},
+	"s":         {Tag: "s"},
+	"strike":    {Tag: "s"},
+	"character": {Tag: "span", Class: "character"},
+}
+
+// HTML renders attributed strings as HTML. Text is escaped, and attributes
+// become elements, which are always properly nested.
+type HTML struct {
+	// Elements maps attribute names to elements. If Elements is nil,
+	// DefaultHTMLElements is used.
+	Elements map[string]HTMLElement
+
+	// ClassPrefix, if not empty, causes attributes not in Elements to be
+	// rendered as span elements with the class ClassPrefix + name (for
+	// example, with ClassPrefix "yarn-", [wave] becomes
+	// <span class="yarn-wave">). Otherwise they are not rendered.
+	ClassPrefix string
+
+	// DataProps adds the properties of each attribute to its element as
+	// data-* attributes (for example, [wave speed=2] becomes
+	// <span class="yarn-wave" data-speed="2">). Properties with names
+	// containing anything other than ASCII letters, digits, '_', and '-' are
+	// skipped.
+	DataProps bool
+}
+
+// element returns the element for an attribute, if it is rendered.
+func (r *HTML) element(a *yarn.Attribute) (HTMLElement, bool) {
+	elems := r.Elements
+	if elems == nil {
+		elems = DefaultHTMLElements
+	}
+	if e, ok := elems[a.Name]; ok {
+		return e, e.Tag != ""
+	}
+	if r.ClassPrefix != "" {
+		return HTMLElement{Tag: "span", Class: r.ClassPrefix + a.Name}, true
+	}
+	return HTMLElement{}, false
+}
+
+// Render renders s as HTML.
+func (r *HTML) Render(s *yarn.AttributedString) string {
+	var sb strings.Builder
+	walk(s, func(a *yarn.Attribute) bool {
+		_, ok := r.element(a)
+		return ok
+	}, func(text string) {
+		sb.WriteString(html.EscapeString(text))
+	}, func(a *yarn.Attribute) {
+		e, _ := r.element(a)
+		sb.WriteString("<" + e.Tag)
+		if e.Class != "" {
+			sb.WriteString(` class="` + html.EscapeString(e.Class) + `"`)
+		}
+		if r.DataProps {
+			for _, k := range sortedProps(a) {
+				if !validDataKey(k) {
+					continue
+				}
+				v := a.Props[k]
+				if v.Kind() == yarn.BoolKind || v.Kind() == yarn.NumberKind {
+					sb.WriteString(` data-` + k + `="` + propString(v) + `"`)
+					continue
+				}
+				sb.WriteString(` data-` + k + `="` + html.EscapeString(v.String()) + `"`)
+			}
+		}
+		sb.WriteString(">")
+	}, func(a *yarn.Attribute) {
+		e, _ := r.element(a)
+		sb.WriteString("</" + e.Tag + ">")
+	})
+	return sb.String()
+}
+
+// validDataKey reports whether k can be used in a data-* attribute name
+// without escaping: it is non-empty and contains only ASCII letters, digits,
+// '_', and '-'.
+func validDataKey(k string) bool {
+	if k == "" {
+		return false
+	}
+	for _, c := range k {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package render converts yarn.AttributedStrings (rendered lines of dialogue,
+// with attributes from markup tags) into text for displaying in various
+// places: terminals (ANSI), web pages (HTML), and engines that accept BBCode
+// or similar rich text.
+//
+// Attributes that mark up nothing, such as those from self-closing tags
+// ([pause/]), are not rendered.
+package render
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"drjosh.dev/yarn"
+)
+
+// Renderer is implemented by each of the renderers in this package.
+type Renderer interface {
+	Render(*yarn.AttributedString) string
+}
+
+var (
+	_ Renderer = (*ANSI)(nil)
+	_ Renderer = (*HTML)(nil)
+	_ Renderer = (*BBCode)(nil)
+)
+
+// walk calls text with the text of each span of s, surrounded by calls to open
+// and close for the attributes selected by keep, so that they are properly
+// nested. Where attributes overlap (for example, "[a]x[b]y[/a]z[/b]"), the
+// inner attribute is closed and reopened.
+func walk(s *yarn.AttributedString, keep func(*yarn.Attribute) bool, text func(string), open, close func(*yarn.Attribute)) {
+	var stack []*yarn.Attribute
+	for _, sp := range s.Spans() {
+		var active []*yarn.Attribute
+		for _, a := range sp.Attributes {
+			if keep(a) {
+				active = append(active, a)
+			}
+		}
+		// Keep the part of the stack that is still active, and close the
+		// rest (innermost first).
+		n := 0
+		for n < len(stack) && n < len(active) && stack[n] == active[n] {
+			n++
+		}
+		for i := len(stack) - 1; i >= n; i-- {
+			close(stack[i])
+		}
+		stack = stack[:n]
+		for _, a := range active[n:] {
+			open(a)
+			stack = append(stack, a)
+		}
+		text(sp.Text)
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		close(stack[i])
+	}
+}
+
+// sortedProps returns the property names of a, sorted.
+func sortedProps(a *yarn.Attribute) []string {
+	keys := make([]string, 0, len(a.Props))
+	for k := range a.Props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// propString formats a property value as it would be written in markup:
+// numbers and bools (lowercase) as-is, and strings quoted if needed.
+func propString(v yarn.Value) string {
+	switch v.Kind() {
+	case yarn.BoolKind:
+		return strconv.FormatBool(v.Bool())
+	case yarn.NumberKind:
+		return v.String()
+	}
+	s := v.String()
+	if s == "" || strings.ContainsAny(s, " \t\"[]=\\/") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,133 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"drjosh.dev/yarn"
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/text/language"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// goldenInputs are rendered by each renderer, and the results compared with
+// testdata/<renderer>.golden.
+var goldenInputs = []string{
+	"Plain text, nothing to see here.",
+	"Mae: [b]Hello[/b] [i]there[/i] friend",
+	"[b]Bold [i]and italic[/i] and bold[/b] and plain",
+	"[b]Bold [i]overlapping[/b] italic[/i] text",
+	"[red]Red [u]underlined[/u] still red[/red]",
+	"[wave speed=2 label=\"so wavy\"]Wavy [shake=3]text[/shake][/wave]",
+	"[b]unclosed",
+	"Special <chars> & \\[brackets\\] \"quoted\"",
+	"A pause[pause/] in the middle",
+	"[character name=\"Mae\" /][nomarkup][b]not bold[/b][/nomarkup]",
+}
+
+func TestGolden(t *testing.T) {
+	renderers := []struct {
+		name  string
+		r     Renderer
+		quote bool
+	}{
+		{name: "ansi", r: &ANSI{}, quote: true},
+		{name: "html", r: &HTML{}},
+		{name: "html_classes", r: &HTML{ClassPrefix: "yarn-", DataProps: true}},
+		{name: "bbcode", r: &BBCode{}},
+		{name: "bbcode_godot", r: &BBCode{PassThrough: true, Escape: EscapeGodot}},
+	}
+	for _, rr := range renderers {
+		t.Run(rr.name, func(t *testing.T) {
+			var sb strings.Builder
+			for _, input := range goldenInputs {
+				row := &yarn.StringTableRow{Text: input}
+				as, err := row.Render(nil, language.English)
+				if err != nil {
+					t.Fatalf("Render(%q) = %v", input, err)
+				}
+				got := rr.r.Render(as)
+				if rr.quote {
+					got = strconv.Quote(got)
+				}
+				sb.WriteString("# " + input + "\n" + got + "\n\n")
+			}
+			path := "testdata/" + rr.name + ".golden"
+			if *update {
+				if err := os.WriteFile(path, []byte(sb.String()), 0o644); err != nil {
+					t.Fatalf("os.WriteFile(%q) = %v", path, err)
+				}
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("os.ReadFile(%q) = %v", path, err)
+			}
+			if diff := cmp.Diff(sb.String(), string(want)); diff != "" {
+				t.Errorf("rendered output diff (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCustomMaps(t *testing.T) {
+	row := &yarn.StringTableRow{Text: "[em]Really[/em] [color value=red]red[/color]"}
+	as, err := row.Render(nil, language.English)
+	if err != nil {
+		t.Fatalf("Render() = %v", err)
+	}
+	tests := []struct {
+		r    Renderer
+		want string
+	}{
+		{
+			r:    &ANSI{Styles: map[string]string{"em": "\033[3m"}},
+			want: "\033[3mReally\033[0m red",
+		},
+		{
+			r:    &HTML{Elements: map[string]HTMLElement{"em": {Tag: "em", Class: "loud"}}},
+			want: `<em class="loud">Really</em> red`,
+		},
+		{
+			r:    &BBCode{Tags: map[string]string{"em": "i", "color": "color=#f00"}},
+			want: "[i]Really[/i] [color=#f00]red[/color]",
+		},
+	}
+	for _, test := range tests {
+		if got := test.r.Render(as); got != test.want {
+			t.Errorf("%T.Render() = %q, want %q", test.r, got, test.want)
+		}
+	}
+}
+
+func TestHTMLDataPropsHostileKeys(t *testing.T) {
+	as := &yarn.AttributedString{}
+	in := `{"text":"hi","attributes":[{"start":0,"end":2,"name":"wave","props":{` +
+		`"speed":2,"x onmouseover=alert(1) y":"z","a>b":"c","":"d"}}]}`
+	if err := as.UnmarshalJSON([]byte(in)); err != nil {
+		t.Fatalf("UnmarshalJSON() = %v", err)
+	}
+	r := &HTML{ClassPrefix: "yarn-", DataProps: true}
+	want := `<span class="yarn-wave" data-speed="2">hi</span>`
+	if got := r.Render(as); got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+}
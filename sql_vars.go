@@ -0,0 +1,400 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultSQLTable is the table used by SQLVariableStorage if Table is empty.
+const DefaultSQLTable = "yarn_variables"
+
+// Used to check table names before they are interpolated into queries.
+var sqlIdentRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// DollarPlaceholder returns PostgreSQL-style placeholders ($1, $2, ...), for
+// use as SQLVariableStorage.Placeholder.
+func DollarPlaceholder(n int) string { return "$" + strconv.Itoa(n) }
+
+var (
+	_ TypedVariableStorage     = &SQLVariableStorage{}
+	_ FlushableVariableStorage = &SQLVariableStorage{}
+	_ FallibleVariableStorage  = &SQLVariableStorage{}
+)
+
+// SQLVariableStorage implements VariableStorage using a database/sql
+// database. Each session (for example, each player) has its own set of
+// variables, identified by SessionID. Each variable is stored in one row, with
+// a column for the kind of value, and one column for each kind:
+//
+//	CREATE TABLE yarn_variables (
+//	  session_id   TEXT NOT NULL,
+//	  name         TEXT NOT NULL,
+//	  kind         INTEGER NOT NULL, -- see ValueKind
+//	  bool_value   BOOLEAN,
+//	  number_value DOUBLE PRECISION,
+//	  string_value TEXT,
+//	  PRIMARY KEY (session_id, name)
+//	)
+//
+// NaN and infinite numbers are stored in string_value (as "NaN", "Infinity",
+// or "-Infinity"), since not every database can store them as numbers.
+//
+// (see CreateTable). All of the session's variables are read from the
+// database on first use. Writes are kept in memory until Flush is called, and
+// then written in a single transaction. SQLVariableStorage implements
+// FlushableVariableStorage, so the VM flushes writes when each node is
+// complete, and when the dialogue is complete.
+//
+// Because GetValue and SetValue cannot return errors, database errors are
+// reported by Err (SQLVariableStorage implements FallibleVariableStorage).
+type SQLVariableStorage struct {
+	// DB is the database to use.
+	DB *sql.DB
+
+	// Table is the name of the table. If empty, DefaultSQLTable is used. It
+	// must be a plain identifier (optionally qualified with a schema name).
+	Table string
+
+	// SessionID identifies the set of variables to use.
+	SessionID string
+
+	// Placeholder returns the query placeholder for argument n (starting at
+	// 1). If nil, "?" is used for every argument (as used by SQLite and
+	// MySQL). For PostgreSQL, use DollarPlaceholder.
+	Placeholder func(n int) string
+
+	mu      sync.Mutex
+	loaded  bool
+	cache   map[string]Value
+	pending map[string]*Value // nil value = delete
+	cleared bool              // delete all rows for session before pending
+	err     error
+}
+
+func (s *SQLVariableStorage) table() (string, error) {
+	t := s.Table
+	if t == "" {
+		t = DefaultSQLTable
+	}
+	if !sqlIdentRE.MatchString(t) {
+		return "", fmt.Errorf("invalid table name %q", t)
+	}
+	return t, nil
+}
+
+// query replaces each ? in q with the configured placeholder.
+func (s *SQLVariableStorage) query(q string) string {
+	if s.Placeholder == nil {
+		return q
+	}
+	var sb strings.Builder
+	n := 0
+	for _, r := range q {
+		if r != '?' {
+			sb.WriteRune(r)
+			continue
+		}
+		n++
+		sb.WriteString(s.Placeholder(n))
+	}
+	return sb.String()
+}
+
+// CreateTable creates the table, if it does not already exist.
+func (s *SQLVariableStorage) CreateTable(ctx context.Context) error {
+	t, err := s.table()
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+t+` (
+	session_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	kind INTEGER NOT NULL,
+	bool_value BOOLEAN,
+	number_value DOUBLE PRECISION,
+	string_value TEXT,
+	PRIMARY KEY (session_id, name)
+)`)
+	if err != nil {
+		return fmt.Errorf("creating table: %w", err)
+	}
+	return nil
+}
+
+// Load reads all the session's variables from the database, discarding any
+// unflushed writes. It is called automatically on first use, but can be
+// called earlier to control the context used, or later to refresh.
+func (s *SQLVariableStorage) Load(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(ctx); err != nil {
+		return err
+	}
+	s.err = nil
+	return nil
+}
+
+func (s *SQLVariableStorage) loadLocked(ctx context.Context) error {
+	t, err := s.table()
+	if err != nil {
+		return err
+	}
+	rows, err := s.DB.QueryContext(ctx, s.query(`SELECT name, kind, bool_value, number_value, string_value FROM `+t+` WHERE session_id = ?`), s.SessionID)
+	if err != nil {
+		return fmt.Errorf("querying variables: %w", err)
+	}
+	defer rows.Close()
+	cache := make(map[string]Value)
+	for rows.Next() {
+		var (
+			name string
+			kind int
+			b    sql.NullBool
+			n    sql.NullFloat64
+			str  sql.NullString
+		)
+		if err := rows.Scan(&name, &kind, &b, &n, &str); err != nil {
+			return fmt.Errorf("scanning variable: %w", err)
+		}
+		switch ValueKind(kind) {
+		case NullKind:
+			cache[name] = Value{}
+		case BoolKind:
+			cache[name] = BoolValue(b.Bool)
+		case NumberKind:
+			if !n.Valid && str.Valid {
+				x, err := ParseNumber(str.String)
+				if err != nil {
+					return fmt.Errorf("variable %q: %w", name, err)
+				}
+				cache[name] = NumberValue(x)
+				break
+			}
+			cache[name] = NumberValue(n.Float64)
+		case StringKind:
+			cache[name] = StringValue(str.String)
+		default:
+			return fmt.Errorf("variable %q has invalid kind %d", name, kind)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("reading variables: %w", err)
+	}
+	s.cache = cache
+	s.pending = nil
+	s.cleared = false
+	s.loaded = true
+	return nil
+}
+
+// ensureLoadedLocked loads the variables if they haven't been loaded yet.
+// Errors are recorded in s.err.
+func (s *SQLVariableStorage) ensureLoadedLocked() bool {
+	if s.loaded {
+		return true
+	}
+	if s.err != nil {
+		return false
+	}
+	s.err = s.loadLocked(context.Background())
+	return s.err == nil
+}
+
+// Err returns the first error encountered while loading or flushing, or nil.
+// The error is sticky: once an error has occurred, it is returned until Load
+// succeeds.
+func (s *SQLVariableStorage) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// GetTypedValue fetches a value, returning (null, false) if not present.
+func (s *SQLVariableStorage) GetTypedValue(name string) (value Value, found bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ensureLoadedLocked() {
+		return Value{}, false
+	}
+	value, found = s.cache[name]
+	return value, found
+}
+
+// SetTypedValue sets a value. It is written to the database by Flush.
+func (s *SQLVariableStorage) SetTypedValue(name string, value Value) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ensureLoadedLocked() {
+		return
+	}
+	s.cache[name] = value
+	if s.pending == nil {
+		s.pending = make(map[string]*Value)
+	}
+	s.pending[name] = &value
+}
+
+// GetValue fetches a value, returning (nil, false) if not present.
+func (s *SQLVariableStorage) GetValue(name string) (value any, found bool) {
+	v, found := s.GetTypedValue(name)
+	if !found {
+		return nil, false
+	}
+	return v.Interface(), true
+}
+
+// SetValue sets a value. It is written to the database by Flush. Values that
+// are not convertible to Value (see ValueOf) cause an error (see Err).
+func (s *SQLVariableStorage) SetValue(name string, value any) {
+	v, err := ValueOf(value)
+	if err != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.err == nil {
+			s.err = fmt.Errorf("variable %q: %w", name, err)
+		}
+		return
+	}
+	s.SetTypedValue(name, v)
+}
+
+// Delete deletes values. The deletions are written to the database by Flush.
+func (s *SQLVariableStorage) Delete(names ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ensureLoadedLocked() {
+		return
+	}
+	if s.pending == nil {
+		s.pending = make(map[string]*Value)
+	}
+	for _, name := range names {
+		delete(s.cache, name)
+		s.pending[name] = nil
+	}
+}
+
+// Clear deletes all the session's values. The deletion is written to the
+// database by Flush.
+func (s *SQLVariableStorage) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cache = make(map[string]Value)
+	s.pending = nil
+	s.cleared = true
+	s.loaded = true
+}
+
+// Flush writes all pending changes to the database in one transaction.
+func (s *SQLVariableStorage) Flush() error {
+	return s.FlushContext(context.Background())
+}
+
+// FlushContext writes all pending changes to the database in one transaction.
+func (s *SQLVariableStorage) FlushContext(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if len(s.pending) == 0 && !s.cleared {
+		return nil
+	}
+	if err := s.flushLocked(ctx); err != nil {
+		s.err = err
+		return err
+	}
+	s.pending = nil
+	s.cleared = false
+	return nil
+}
+
+func (s *SQLVariableStorage) flushLocked(ctx context.Context) (err error) {
+	t, err := s.table()
+	if err != nil {
+		return err
+	}
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if s.cleared {
+		if _, err := tx.ExecContext(ctx, s.query(`DELETE FROM `+t+` WHERE session_id = ?`), s.SessionID); err != nil {
+			return fmt.Errorf("clearing variables: %w", err)
+		}
+	}
+
+	// Write in a deterministic order.
+	names := make([]string, 0, len(s.pending))
+	for name := range s.pending {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	del := s.query(`DELETE FROM ` + t + ` WHERE session_id = ? AND name = ?`)
+	ins := s.query(`INSERT INTO ` + t + ` (session_id, name, kind, bool_value, number_value, string_value) VALUES (?, ?, ?, ?, ?, ?)`)
+	for _, name := range names {
+		if _, err := tx.ExecContext(ctx, del, s.SessionID, name); err != nil {
+			return fmt.Errorf("deleting variable %q: %w", name, err)
+		}
+		v := s.pending[name]
+		if v == nil {
+			continue
+		}
+		var (
+			b   sql.NullBool
+			n   sql.NullFloat64
+			str sql.NullString
+		)
+		switch v.kind {
+		case BoolKind:
+			b = sql.NullBool{Bool: v.Bool(), Valid: true}
+		case NumberKind:
+			if math.IsNaN(v.num) || math.IsInf(v.num, 0) {
+				// Not every database can store these (SQLite turns NaN
+				// into NULL), so they are stored as text.
+				str = sql.NullString{String: formatNumber(v.num, 64), Valid: true}
+				break
+			}
+			n = sql.NullFloat64{Float64: v.num, Valid: true}
+		case StringKind:
+			str = sql.NullString{String: v.str, Valid: true}
+		case OpaqueKind:
+			return fmt.Errorf("variable %q: opaque %T %w to SQL", name, v.obj, ErrNotConvertible)
+		}
+		if _, err := tx.ExecContext(ctx, ins, s.SessionID, name, int(v.kind), b, n, str); err != nil {
+			return fmt.Errorf("inserting variable %q: %w", name, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+	return nil
+}
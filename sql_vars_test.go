@@ -0,0 +1,190 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	_ "modernc.org/sqlite"
+)
+
+// openTestSQL opens a new SQLite database for the test.
+func openTestSQL(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "vars.db"))
+	if err != nil {
+		t.Fatalf("sql.Open = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// countRows returns the number of rows in the default table.
+func countRows(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM ` + DefaultSQLTable).Scan(&n); err != nil {
+		t.Fatalf("counting rows: %v", err)
+	}
+	return n
+}
+
+func TestSQLVariableStorageRoundTrip(t *testing.T) {
+	db := openTestSQL(t)
+	s := &SQLVariableStorage{DB: db, SessionID: "alice"}
+	if err := s.CreateTable(context.Background()); err != nil {
+		t.Fatalf("CreateTable = %v", err)
+	}
+	s.SetValue("$bool", true)
+	s.SetValue("$number", 42)
+	s.SetValue("$string", "hi")
+	s.SetValue("$gone", "bye")
+	s.Delete("$gone")
+
+	// Nothing is written before Flush.
+	if got := countRows(t, db); got != 0 {
+		t.Errorf("before Flush, database has %d rows, want 0", got)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush() = %v", err)
+	}
+	if got, want := countRows(t, db), 3; got != want {
+		t.Errorf("after Flush, database has %d rows, want %d", got, want)
+	}
+
+	// Another session sees nothing; the same session sees everything.
+	bob := &SQLVariableStorage{DB: db, SessionID: "bob"}
+	if _, ok := bob.GetValue("$bool"); ok {
+		t.Error("bob.GetValue($bool) ok = true, want false")
+	}
+	alice := &SQLVariableStorage{DB: db, SessionID: "alice"}
+	got := make(map[string]any)
+	for _, name := range []string{"$bool", "$number", "$string", "$gone"} {
+		if v, ok := alice.GetValue(name); ok {
+			got[name] = v
+		}
+	}
+	want := map[string]any{
+		"$bool":   true,
+		"$number": float32(42),
+		"$string": "hi",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("loaded variables diff (-got +want):\n%s", diff)
+	}
+	if err := alice.Err(); err != nil {
+		t.Errorf("alice.Err() = %v", err)
+	}
+}
+
+func TestSQLVariableStorageNonFinite(t *testing.T) {
+	db := openTestSQL(t)
+	s := &SQLVariableStorage{DB: db, SessionID: "alice"}
+	if err := s.CreateTable(context.Background()); err != nil {
+		t.Fatalf("CreateTable = %v", err)
+	}
+	want := map[string]any{
+		"$nan":        float32(math.NaN()),
+		"$inf":        float32(math.Inf(1)),
+		"$neg_inf":    float32(math.Inf(-1)),
+		"$nan_string": "NaN",
+	}
+	for name, v := range want {
+		s.SetValue(name, v)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush() = %v", err)
+	}
+
+	alice := &SQLVariableStorage{DB: db, SessionID: "alice"}
+	got := make(map[string]any)
+	for name := range want {
+		if v, ok := alice.GetValue(name); ok {
+			got[name] = v
+		}
+	}
+	if err := alice.Err(); err != nil {
+		t.Errorf("alice.Err() = %v", err)
+	}
+	if diff := cmp.Diff(got, want, cmpopts.EquateNaNs()); diff != "" {
+		t.Errorf("loaded variables diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestSQLVariableStorageWithVM(t *testing.T) {
+	db := openTestSQL(t)
+	s := &SQLVariableStorage{DB: db, SessionID: "player1"}
+	if err := s.CreateTable(context.Background()); err != nil {
+		t.Fatalf("CreateTable = %v", err)
+	}
+
+	runTestPlan(t, "VariableStorage", s, NumericFloat32)
+	if countRows(t, db) == 0 {
+		t.Error("database has no rows after vm.Run, want some")
+	}
+}
+
+func TestSQLVariableStorageErrorStopsVM(t *testing.T) {
+	db := openTestSQL(t)
+	s := &SQLVariableStorage{DB: db, SessionID: "player1"}
+	if err := s.CreateTable(context.Background()); err != nil {
+		t.Fatalf("CreateTable = %v", err)
+	}
+	// Reading works, but writing fails.
+	if _, err := db.Exec(`CREATE TRIGGER fail_writes BEFORE INSERT ON ` + DefaultSQLTable + `
+BEGIN
+	SELECT RAISE(ABORT, 'disk full');
+END`); err != nil {
+		t.Fatalf("creating trigger: %v", err)
+	}
+	vm := &VirtualMachine{
+		Program: loopProgram(1),
+		Handler: FakeDialogueHandler{},
+		Vars:    s,
+	}
+	if err := vm.Run("Start"); err == nil {
+		t.Error("vm.Run(Start) = nil, want error")
+	}
+	if err := s.Err(); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("s.Err() = %v, want disk full error", err)
+	}
+}
+
+func TestSQLVariableStoragePlaceholder(t *testing.T) {
+	s := &SQLVariableStorage{Placeholder: DollarPlaceholder}
+	got := s.query("DELETE FROM t WHERE session_id = ? AND name = ?")
+	want := "DELETE FROM t WHERE session_id = $1 AND name = $2"
+	if got != want {
+		t.Errorf("query = %q, want %q", got, want)
+	}
+}
+
+func TestSQLVariableStorageBadTable(t *testing.T) {
+	db := openTestSQL(t)
+	s := &SQLVariableStorage{DB: db, Table: "x; DROP TABLE y", SessionID: "p"}
+	if _, ok := s.GetValue("$x"); ok {
+		t.Error("GetValue ok = true, want false")
+	}
+	if err := s.Err(); err == nil {
+		t.Error("Err() = nil, want error")
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"errors"
+	"testing"
+
+	yarnpb "drjosh.dev/yarn/bytecode"
+)
+
+// lineProgram returns a program that delivers a line with the value of a
+// variable as a substitution.
+func lineProgram(varname string) *yarnpb.Program {
+	node := &yarnpb.Node{
+		Name: "Start",
+		Instructions: []*yarnpb.Instruction{
+			{
+				Opcode:   yarnpb.Instruction_PUSH_VARIABLE,
+				Operands: []*yarnpb.Operand{StringValue(varname).Operand()},
+			},
+			{
+				Opcode: yarnpb.Instruction_RUN_LINE,
+				Operands: []*yarnpb.Operand{
+					StringValue("line:1").Operand(),
+					NumberValue(1).Operand(),
+				},
+			},
+			{Opcode: yarnpb.Instruction_STOP},
+		},
+	}
+	return &yarnpb.Program{Nodes: map[string]*yarnpb.Node{"Start": node}}
+}
+
+// branchProgram returns a program that branches on v.
+func branchProgram(v Value) *yarnpb.Program {
+	node := &yarnpb.Node{
+		Name: "Start",
+		Instructions: []*yarnpb.Instruction{
+			{Opcode: yarnpb.Instruction_PUSH_FLOAT, Operands: []*yarnpb.Operand{v.Operand()}},
+			{Opcode: yarnpb.Instruction_JUMP_IF_FALSE, Operands: []*yarnpb.Operand{StringValue("end").Operand()}},
+			{Opcode: yarnpb.Instruction_STOP},
+		},
+		Labels: map[string]int32{"end": 2},
+	}
+	return &yarnpb.Program{Nodes: map[string]*yarnpb.Node{"Start": node}}
+}
+
+func TestStrictMode(t *testing.T) {
+	declare := func(prog *yarnpb.Program, name string, v Value) *yarnpb.Program {
+		if prog.InitialValues == nil {
+			prog.InitialValues = make(map[string]*yarnpb.Operand)
+		}
+		prog.InitialValues[name] = v.Operand()
+		return prog
+	}
+	tests := []struct {
+		name string
+		prog *yarnpb.Program
+		vars map[string]any
+		want error
+	}{
+		{
+			name: "declared",
+			prog: declare(callProgram("Number.Add", NumberValue(1), NumberValue(2)), "$result", NumberValue(0)),
+		},
+		{
+			name: "undeclared store",
+			prog: callProgram("Number.Add", NumberValue(1), NumberValue(2)),
+			want: ErrUndeclaredVariable,
+		},
+		{
+			name: "store wrong type",
+			prog: declare(callProgram("Number.Add", NumberValue(1), NumberValue(2)), "$result", StringValue("")),
+			want: ErrWrongType,
+		},
+		{
+			name: "implicit conversion",
+			prog: declare(callProgram("Number.Add", NumberValue(1), StringValue("2")), "$result", NumberValue(0)),
+			want: ErrImplicitConversion,
+		},
+		{
+			name: "null argument",
+			prog: declare(callProgram("None", NullValue()), "$result", NumberValue(0)),
+			want: ErrNullValue,
+		},
+		{
+			name: "any argument",
+			prog: declare(callProgram("None", NumberValue(1)), "$result", NumberValue(0)),
+		},
+		{
+			name: "compare different kinds",
+			prog: declare(callProgram("EqualTo", NumberValue(1), StringValue("1")), "$result", BoolValue(false)),
+			want: ErrImplicitConversion,
+		},
+		{
+			name: "compare same kinds",
+			prog: declare(callProgram("EqualTo", StringValue("1"), StringValue("1")), "$result", BoolValue(false)),
+		},
+		{
+			name: "add different kinds",
+			prog: declare(callProgram("Add", StringValue("a"), NumberValue(1)), "$result", StringValue("")),
+			want: ErrImplicitConversion,
+		},
+		{
+			name: "branch on number",
+			prog: branchProgram(NumberValue(1)),
+			want: ErrImplicitConversion,
+		},
+		{
+			name: "undeclared push",
+			prog: lineProgram("$x"),
+			vars: map[string]any{"$x": "set but undeclared"},
+			want: ErrUndeclaredVariable,
+		},
+		{
+			name: "declared push uses default",
+			prog: declare(lineProgram("$x"), "$x", StringValue("default")),
+		},
+		{
+			name: "null substitution",
+			prog: declare(lineProgram("$x"), "$x", NullValue()),
+			want: ErrNullValue,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vm := &VirtualMachine{
+				Program: test.prog,
+				Handler: FakeDialogueHandler{},
+				Vars:    NewMapVariableStorageFromMap(test.vars),
+				Strict:  true,
+			}
+			if err := vm.Run("Start"); !errors.Is(err, test.want) {
+				t.Errorf("strict vm.Run(Start) = %v, want %v", err, test.want)
+			}
+
+			// Everything is fine when not strict.
+			vm.Strict = false
+			if err := vm.Run("Start"); err != nil {
+				t.Errorf("lenient vm.Run(Start) = %v", err)
+			}
+		})
+	}
+}
@@ -20,9 +20,10 @@ import (
 	"io"
 	"io/fs"
 	"os"
-	"sort"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/alecthomas/participle/v2"
 	"github.com/alecthomas/participle/v2/lexer"
@@ -38,6 +39,27 @@ import (
 type StringTable struct {
 	Language language.Tag
 	Table    map[string]*StringTableRow
+
+	// LocalSubstitutions turns on formatting numeric substitutions for the
+	// language (see Render). Otherwise substitutions are rendered exactly as
+	// in Line.Substitutions.
+	LocalSubstitutions bool
+
+	// MarkupProcessors optionally implements custom markup tags when
+	// rendering lines from the table.
+	MarkupProcessors MarkupProcessorMap
+
+	// MissingKeys controls what happens when a select, plural, or ordinal
+	// format function has no property for the chosen key (for example, a
+	// translation provides one="..." and other="..." but the language also
+	// needs few="..."). DefaultFormatKey is the last key to fall back to
+	// under FallbackMissingKeys.
+	MissingKeys      MissingKeyPolicy
+	DefaultFormatKey string
+
+	// MissingKeyFunc, if not nil, is called each time a format function has
+	// no property for the chosen key, whether or not there is a fallback.
+	MissingKeyFunc func(lineID, funcName, key string)
 }
 
 // LoadStringTableFile is a convenient function for loading a CSV string table
@@ -171,12 +193,28 @@ func (t *StringTable) readMetadata(r io.Reader) error {
 // Render looks up the row corresponding to line.ID, interpolates substitutions
 // (from line.Substitutions), applies format functions, and processes style
 // tags into attributes.
+//
+// If LocalSubstitutions is set and the line has Values (as lines from the VM
+// do), numeric substitutions are formatted for the table's language, with
+// the language's grouping separators, for example 1234.5 becomes "1.234,5"
+// in German. Format functions such as plural still use the invariant
+// (Substitutions) form of the value to choose the plural form.
 func (t *StringTable) Render(line Line) (*AttributedString, error) {
 	row := t.Table[line.ID]
 	if row == nil {
 		return nil, fmt.Errorf("string table row for id %q not found or nil", line.ID)
 	}
-	return row.Render(line.Substitutions, t.Language)
+	lr := lineRenderer{
+		substs: line.Substitutions,
+		lang:   t.Language,
+		procs:  t.MarkupProcessors,
+		table:  t,
+		lineID: line.ID,
+	}
+	if t.LocalSubstitutions && len(line.Values) == len(line.Substitutions) {
+		lr.values = line.Values
+	}
+	return row.render(&lr)
 }
 
 // StringTableRow contains all the information from one row in a string table.
@@ -193,12 +231,30 @@ type StringTableRow struct {
 // Render interpolates substitutions, applies format functions, and processes
 // style tags into attributes.
 func (r *StringTableRow) Render(substs []string, lang language.Tag) (*AttributedString, error) {
-	if err := r.parseIfNeeded(); err != nil {
-		return nil, err
+	return r.render(&lineRenderer{
+		substs: substs,
+		lang:   lang,
+	})
+}
+
+// RenderValues is like Render, but with typed substitution values. Numeric
+// values are formatted for the language (see StringTable.Render).
+func (r *StringTableRow) RenderValues(values []Value, lang language.Tag) (*AttributedString, error) {
+	substs := make([]string, len(values))
+	for i, v := range values {
+		substs[i] = v.String()
 	}
-	lr := lineRenderer{
+	return r.render(&lineRenderer{
 		substs: substs,
+		values: values,
 		lang:   lang,
+	})
+}
+
+// render renders the row using lr.
+func (r *StringTableRow) render(lr *lineRenderer) (*AttributedString, error) {
+	if err := r.parseIfNeeded(); err != nil {
+		return nil, err
 	}
 	if err := lr.renderString(r.parsedText); err != nil {
 		return nil, err
@@ -221,63 +277,17 @@ func (r *StringTableRow) parseIfNeeded() error {
 	return nil
 }
 
-// AttributedString is a string with additional attributes, such as presentation
-// or styling information, that apply to the whole string or substrings.
-type AttributedString struct {
-	str  string
-	atts map[int][]*Attribute // position -> attributes starting or ending here
-}
-
-func (s *AttributedString) String() string { return s.str }
-
-// ScanAttribEvents calls visit with each change in attribute state. pos is the
-// byte position in the string where the change occurs. atts will contain the
-// attributes that either start or end at pos, in the same order they were read
-// from the original markup. Self-closing tags, or an open and close pair that
-// apply to the same position (i.e. marking up nothing) will only be present in
-// atts once (in the order of the start tag).
-// For example, for the original string:
-//
-//	`[a]Hello A[/a] [b]Hello B[/b] [c][d][/c]No C, [e/]only D[/d]`
-//
-// which is processed into the unattributed string:
-//
-//	`Hello A Hello B No C, only D`
-//
-// ScanAttribEvents will visit:
-// * (0, [a])    -- open of a
-// * (7, [a])    -- close of a
-// * (8, [b])    -- open of b
-// * (15, [b])   -- close of b
-// * (16, [c,d]) -- close of c applies to same position, so it appears once
-// * (22, [e])   -- e is self-closing, so it appears once
-// * (28, [d])   -- close of d
-func (s *AttributedString) ScanAttribEvents(visit func(pos int, atts []*Attribute)) {
-	events := make([]int, 0, len(s.atts))
-	for i := range s.atts {
-		events = append(events, i)
-	}
-	sort.Ints(events)
-	for _, pos := range events {
-		visit(pos, s.atts[pos])
-	}
-}
-
-// Attribute describes a range within a string with additional information
-// provided by markup tags. Start and End specify the range in bytes. Name is
-// the tag name, and Props contains any additional key="value" tag properties.
-type Attribute struct {
-	Start, End int
-	Name       string
-	Props      map[string]string
-}
+// TrimWhitespaceProperty is the name of the markup property that controls
+// whether a self-closing tag removes the whitespace following it.
+const TrimWhitespaceProperty = "trimwhitespace"
 
 var (
 	// This lexer is a bit more general than needed since it allows things like
 	// nested functions, but... hey I get nested functions for ~free!
 	lineLexer = lexer.MustStateful(lexer.Rules{
 		"Root": {
-			{Name: "Escaped", Pattern: `\\[\{\}\[\]"\\]`, Action: nil},
+			{Name: "Escaped", Pattern: `\\[\{\}\[\]"\\:]`, Action: nil},
+			{Name: "NoMarkupStart", Pattern: `\[nomarkup\]`, Action: lexer.Push("NoMarkup")},
 			{Name: "Markup", Pattern: `\[`, Action: lexer.Push("Markup")},
 			{Name: "Subst", Pattern: `{`, Action: lexer.Push("Subst")},
 			{Name: "Char", Pattern: `[%\{\["\\]|[^%\{\["\\]+`, Action: nil},
@@ -285,12 +295,17 @@ var (
 		"Markup": {
 			{Name: "Whitespace", Pattern: `\s+`, Action: nil},
 			{Name: "Slash", Pattern: `/`, Action: nil},
+			{Name: "Number", Pattern: `-?\d+(\.\d+)?\b`, Action: nil},
 			{Name: "Ident", Pattern: `\w+`, Action: nil},
 			{Name: "Equals", Pattern: `=`, Action: nil},
 			{Name: "Subst", Pattern: `{`, Action: lexer.Push("Subst")},
 			{Name: "String", Pattern: `"`, Action: lexer.Push("String")},
 			{Name: "MarkupEnd", Pattern: `\]`, Action: lexer.Pop()},
 		},
+		"NoMarkup": {
+			{Name: "NoMarkupEnd", Pattern: `\[/nomarkup\]`, Action: lexer.Pop()},
+			{Name: "Raw", Pattern: `\[|[^\[]+`, Action: nil},
+		},
 		"Subst": {
 			{Name: "Index", Pattern: `\d+`, Action: nil},
 			{Name: "SubstEnd", Pattern: `}`, Action: lexer.Pop()},
@@ -318,78 +333,153 @@ type parsedString struct {
 // that special pieces (escape sequences, markup, substitutions, and %) can be
 // processed in a special way.
 type fragment struct {
-	Escaped string           `parser:"@Escaped"`
-	Markup  *parsedMarkupTag `parser:"| Markup @@ MarkupEnd"`
-	Subst   string           `parser:"| Subst @Index SubstEnd"`
-	Text    string           `parser:"| @Char"`
+	Escaped  string           `parser:"@Escaped"`
+	NoMarkup *noMarkup        `parser:"| @@"`
+	Markup   *parsedMarkupTag `parser:"| Markup @@ MarkupEnd"`
+	Subst    string           `parser:"| Subst @Index SubstEnd"`
+	Text     string           `parser:"| @Char"`
+}
+
+// noMarkup is the content of [nomarkup]...[/nomarkup], which is not parsed
+// for markup or escapes.
+type noMarkup struct {
+	Start string   `parser:"@NoMarkupStart"`
+	Raw   []string `parser:"@Raw* NoMarkupEnd"`
 }
 
 // stringOrSubst appears inside markup tags. The value={0} prop is emitted
-// without quoting the substitution token. Other props are usually of the form
-// key="value".
+// without quoting the substitution token. Other props are of the form
+// key="value", or key=value for numbers, bools, and single words.
 type stringOrSubst struct {
 	String *parsedString `parser:"String @@ StringEnd"`
 	Subst  string        `parser:" | Subst @Index SubstEnd"`
+	Bare   string        `parser:" | @(Number | Ident)"`
 }
 
 // parsedMarkupTag is used for both format functions (select, plural, ordinal) and
 // BBCode-esque markup tags ([b]Bold!?[/b]).
 type parsedMarkupTag struct {
-	OpeningSlash string        `parser:"@Slash?"` // indicates closing tag of a pair
-	Name         string        `parser:"@Ident?"` // used for all except close-all tag [/]
-	Props        []*parsedProp `parser:"@@*"`     // optional key="value" or value={0} properties
-	ClosingSlash string        `parser:"@Slash?"` // indicates self-closing tag
+	OpeningSlash string         `parser:"@Slash?"`      // indicates closing tag of a pair
+	Name         string         `parser:"@Ident?"`      // used for all except close-all tag [/]
+	Value        *stringOrSubst `parser:"(Equals @@)?"` // shorthand for a property named Name ([wave=2])
+	Props        []*parsedProp  `parser:"@@*"`          // optional key="value" or value={0} properties
+	ClosingSlash string         `parser:"@Slash?"`      // indicates self-closing tag
 }
 
 // parsedProp is used for key="value" properties of format funcs and markup
 // tags.
 type parsedProp struct {
-	Key   string         `parser:"@Ident Equals"`
+	Key   string         `parser:"@(Ident | Number) Equals"`
 	Value *stringOrSubst `parser:"@@"` // for ordinary values
 }
 
 type lineRenderer struct {
-	builder strings.Builder
-	attribs map[int][]*Attribute    // lazily created; position -> tag event
-	open    map[string][]*Attribute // lazily created; name -> stack of tags currently open
-	substs  []string
-	lang    language.Tag
+	builder  strings.Builder
+	attribs  []*Attribute            // in the order they were opened
+	open     map[string][]*Attribute // lazily created; name -> stack of tags currently open
+	substs   []string
+	values   []Value // typed substitutions (if non-nil, same length as substs)
+	lang     language.Tag
+	procs    MarkupProcessorMap
+	table    *StringTable // for format function key policy; may be nil
+	lineID   string
+	depth    int  // nesting depth of MarkupRenderer.WriteMarkup
+	colon    int  // position of the first unescaped colon, if sawColon
+	sawColon bool // whether there is an unescaped colon
+	trimNext bool // whether to trim one whitespace character from the next text
 }
 
 func (b *lineRenderer) attStr() *AttributedString {
-	return &AttributedString{
-		str:  b.builder.String(),
-		atts: b.attribs,
+	// Tags still open at the end of the line apply to the rest of the line.
+	b.closeAll()
+	b.addCharacterAttribute()
+	return newAttributedString(b.builder.String(), b.attribs)
+}
+
+// addCharacterAttribute adds the implicit character attribute, in the same
+// way as Yarn Spinner: if the line contains a colon, the text before the
+// colon is the name of the character speaking the line. The attribute spans
+// the name, the colon, and any whitespace following it, for example:
+//
+//	Mae: Hello!
+//
+// is treated like:
+//
+//	[character name="Mae"]Mae: [/character]Hello!
+//
+// Escaped colons (\:), colons inside [nomarkup], and colons in
+// substitutions are ignored. Lines with an explicit [character] tag don't get
+// an implicit one.
+func (b *lineRenderer) addCharacterAttribute() {
+	if !b.sawColon {
+		return
+	}
+	for _, a := range b.attribs {
+		if a.Name == "character" {
+			return
+		}
 	}
+	str := b.builder.String()
+	name := strings.TrimSpace(str[:b.colon])
+	if name == "" {
+		return
+	}
+	end := b.colon + 1
+	end += len(str[end:]) - len(strings.TrimLeftFunc(str[end:], unicode.IsSpace))
+	a := &Attribute{
+		Start: 0,
+		End:   end,
+		Name:  "character",
+		Props: map[string]Value{"name": StringValue(name)},
+	}
+	// The character attribute is conceptually the first tag in the line.
+	b.attribs = append([]*Attribute{a}, b.attribs...)
 }
 
-func (b *lineRenderer) openTag(name string, props []*parsedProp) error {
-	// Render each prop value into its own string, and put into a map
-	var m map[string]string
-	if len(props) > 0 {
-		m = make(map[string]string)
-		for _, prop := range props {
-			v, err := b.evalStringOrSubst(prop.Value)
-			if err != nil {
-				return err
-			}
-			m[prop.Key] = v
+func (b *lineRenderer) openTag(f *parsedMarkupTag) (*Attribute, error) {
+	m, err := b.evalProps(f)
+	if err != nil {
+		return nil, err
+	}
+	return b.openAttribute(f.Name, m), nil
+}
+
+// evalProps evaluates each prop value of the tag, and puts them into a map.
+func (b *lineRenderer) evalProps(f *parsedMarkupTag) (map[string]Value, error) {
+	if f.Value == nil && len(f.Props) == 0 {
+		return nil, nil
+	}
+	m := make(map[string]Value)
+	if f.Value != nil {
+		v, err := b.evalPropValue(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		m[f.Name] = v
+	}
+	for _, prop := range f.Props {
+		v, err := b.evalPropValue(prop.Value)
+		if err != nil {
+			return nil, err
 		}
+		m[prop.Key] = v
 	}
+	return m, nil
+}
+
+// openAttribute starts a new attribute at the current position.
+func (b *lineRenderer) openAttribute(name string, props map[string]Value) *Attribute {
 	a := &Attribute{
 		Start: b.builder.Len(),
 		Name:  name,
-		Props: m,
+		Props: props,
 	}
 	if b.open == nil {
 		b.open = make(map[string][]*Attribute)
 	}
-	if b.attribs == nil {
-		b.attribs = make(map[int][]*Attribute)
-	}
 	b.open[name] = append(b.open[name], a)
-	b.attribs[a.Start] = append(b.attribs[a.Start], a)
-	return nil
+	b.attribs = append(b.attribs, a)
+	return a
 }
 
 func (b *lineRenderer) closeTag(name string) error {
@@ -405,11 +495,6 @@ func (b *lineRenderer) closeTag(name string) error {
 	a, as := as[l-1], as[:l-1]
 	b.open[name] = as
 	a.End = b.builder.Len()
-	if a.Start == a.End {
-		// a is already in b.attribs[a.End]
-		return nil
-	}
-	b.attribs[a.End] = append(b.attribs[a.End], a)
 	return nil
 }
 
@@ -417,13 +502,16 @@ func (b *lineRenderer) closeAll() {
 	for name, as := range b.open {
 		for _, a := range as {
 			a.End = b.builder.Len()
-			b.attribs[a.End] = append(b.attribs[a.End], a)
 		}
 		delete(b.open, name)
 	}
 }
 
 func (b *lineRenderer) renderString(p *parsedString) error {
+	if p == nil {
+		// e.g. the empty string ""
+		return nil
+	}
 	for _, f := range p.Fragments {
 		if err := b.renderFragment(f); err != nil {
 			return err
@@ -436,19 +524,77 @@ func (b *lineRenderer) renderFragment(s *fragment) error {
 	if s == nil {
 		return nil
 	}
+	trim := b.trimNext
+	b.trimNext = false
 	switch {
 	case s.Escaped != "":
 		b.builder.WriteString(s.Escaped[1:])
+	case s.NoMarkup != nil:
+		// Everything up to [/nomarkup] is literal text.
+		b.openAttribute("nomarkup", nil)
+		for _, r := range s.NoMarkup.Raw {
+			b.builder.WriteString(r)
+		}
+		return b.closeTag("nomarkup")
 	case s.Markup != nil:
 		return b.renderMarkupTag(s.Markup)
 	case s.Subst != "":
-		b.builder.WriteString(b.evalSubst(s.Subst))
+		text := b.substText(s.Subst)
+		if trim {
+			text = trimOneSpace(text)
+		}
+		b.builder.WriteString(text)
 	default:
-		b.builder.WriteString(s.Text)
+		text := s.Text
+		if trim {
+			text = trimOneSpace(text)
+		}
+		if i := strings.IndexByte(text, ':'); i >= 0 && !b.sawColon {
+			b.colon = b.builder.Len() + i
+			b.sawColon = true
+		}
+		b.builder.WriteString(text)
 	}
 	return nil
 }
 
+// trimOneSpace removes one leading whitespace character from s, if it has
+// one.
+func trimOneSpace(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	if n > 0 && unicode.IsSpace(r) {
+		return s[n:]
+	}
+	return s
+}
+
+// precededBySpace reports whether the output so far is empty or ends in
+// whitespace.
+func (b *lineRenderer) precededBySpace() bool {
+	r, n := utf8.DecodeLastRuneInString(b.builder.String())
+	return n == 0 || unicode.IsSpace(r)
+}
+
+// substText returns the text to display for a substitution. Numeric values
+// are formatted for the language.
+func (b *lineRenderer) substText(index string) string {
+	v, ok := b.substValue(index)
+	if !ok || v.Kind() != NumberKind {
+		return b.evalSubst(index)
+	}
+	return formatLocalNumber(b.lang, v)
+}
+
+// substValue returns the typed value of a substitution, if there is one.
+func (b *lineRenderer) substValue(index string) (Value, bool) {
+	n, err := strconv.Atoi(index)
+	if err != nil || n < 0 || n >= len(b.values) {
+		return Value{}, false
+	}
+	return b.values[n], true
+}
+
+// evalSubst returns the invariant text of a substitution.
 func (b *lineRenderer) evalSubst(index string) string {
 	n, err := strconv.Atoi(index)
 	if err != nil || n < 0 || n >= len(b.substs) {
@@ -469,6 +615,9 @@ var formKeyTable = []string{
 }
 
 func (b *lineRenderer) renderMarkupTag(f *parsedMarkupTag) error {
+	if ok, err := b.runProcessor(f); ok {
+		return err
+	}
 	switch {
 	case f.Name == "select":
 		// [select value={0} m="bro" f="sis" nb="doc" /]
@@ -482,8 +631,26 @@ func (b *lineRenderer) renderMarkupTag(f *parsedMarkupTag) error {
 		// [ordinal value={0} one="%st" two="%nd" ... /]
 		return b.renderPluralFormatFunc(f, plural.Ordinal)
 
-	case f.OpeningSlash == "/" && f.Name == "":
-		// Close-all tag [/]
+	case f.Name == "number" && isFormatFuncTag(f, true):
+		// [number value={0} decimals=2 /]
+		return b.renderNumberFormatFunc(f, false)
+
+	case f.Name == "percent" && isFormatFuncTag(f, true):
+		// [percent value={0} /]
+		return b.renderNumberFormatFunc(f, true)
+
+	case f.Name == "duration" && isFormatFuncTag(f, true):
+		// [duration value={0} /]
+		return b.renderDurationFormatFunc(f)
+
+	case f.Name == "list" && isFormatFuncTag(f, false):
+		// [list a={0} b={1} c={2} /]
+		return b.renderListFormatFunc(f)
+
+	case f.OpeningSlash == "/" && (f.Name == "" || f.Value != nil):
+		// Close-all tag [/]. Any properties are ignored. Since the first
+		// property of [/ p=1] parses like the name of [/p=1], that is also
+		// treated as close-all.
 		b.closeAll()
 		return nil
 
@@ -492,15 +659,31 @@ func (b *lineRenderer) renderMarkupTag(f *parsedMarkupTag) error {
 		return b.closeTag(f.Name)
 
 	case f.ClosingSlash == "/":
-		// Self-closing tag [foo/]
-		if err := b.openTag(f.Name, f.Props); err != nil {
+		// Self-closing tag [foo/]. Like Yarn Spinner, if the tag is at the
+		// start of the line or follows whitespace, one whitespace character
+		// following the tag is removed, so that "A [foo/] B" becomes "A B".
+		// This can be overridden with the trimwhitespace property.
+		trim := b.precededBySpace()
+		a, err := b.openTag(f)
+		if err != nil {
 			return err
 		}
-		return b.closeTag(f.Name)
+		if tw, ok := a.Props[TrimWhitespaceProperty]; ok {
+			if tw.Kind() != BoolKind {
+				return fmt.Errorf("%s property of tag %q must be a bool [got %v]", TrimWhitespaceProperty, f.Name, tw.Kind())
+			}
+			trim = tw.Bool()
+		}
+		if err := b.closeTag(f.Name); err != nil {
+			return err
+		}
+		b.trimNext = trim
+		return nil
 
 	case f.Name != "":
 		// Open tag [foo]
-		return b.openTag(f.Name, f.Props)
+		_, err := b.openTag(f)
+		return err
 
 	default:
 		// Uhhhhhh... [] ?
@@ -528,12 +711,12 @@ func (b *lineRenderer) renderSelectFormatFunc(f *parsedMarkupTag) error {
 		return err
 	}
 	// Use that value to find the matching property.
-	val, err := b.propValueForKey(f, input)
+	val, err := b.formatKeyValue(f, input)
 	if err != nil {
 		return err
 	}
 	// Render that value to the output!
-	return b.renderFormatFuncValue(val, input)
+	return b.renderFormatFuncValue(val, b.displayValue(f, input))
 }
 
 func (b *lineRenderer) renderPluralFormatFunc(f *parsedMarkupTag, rules *plural.Rules) error {
@@ -552,21 +735,40 @@ func (b *lineRenderer) renderPluralFormatFunc(f *parsedMarkupTag, rules *plural.
 		return fmt.Errorf("plural form %v not supported", form)
 	}
 	// Find the plural form in the properties.
-	val, err := b.propValueForKey(f, formKeyTable[form])
+	val, err := b.formatKeyValue(f, formKeyTable[form])
 	if err != nil {
 		return err
 	}
 	// Render that value to the output!
-	return b.renderFormatFuncValue(val, input)
+	return b.renderFormatFuncValue(val, b.displayValue(f, input))
+}
+
+// displayValue returns the text to display for the value of a format
+// function (in place of %). If the value is a numeric substitution, it is
+// formatted for the language; otherwise it is input.
+func (b *lineRenderer) displayValue(f *parsedMarkupTag, input string) string {
+	val, err := b.propValueForKey(f, "value")
+	if err != nil || val.Subst == "" {
+		return input
+	}
+	return b.substText(val.Subst)
 }
 
 func (b *lineRenderer) evalStringOrSubst(s *stringOrSubst) (string, error) {
 	if s.Subst != "" {
 		return b.evalSubst(s.Subst), nil
 	}
+	if s.Bare != "" {
+		return s.Bare, nil
+	}
 	inb := &lineRenderer{
 		substs: b.substs,
+		values: b.values,
 		lang:   b.lang,
+		procs:  b.procs,
+		table:  b.table,
+		lineID: b.lineID,
+		depth:  b.depth,
 	}
 	if err := inb.renderString(s.String); err != nil {
 		return "", err
@@ -574,6 +776,55 @@ func (b *lineRenderer) evalStringOrSubst(s *stringOrSubst) (string, error) {
 	return inb.builder.String(), nil
 }
 
+// evalPropValue evaluates a markup tag property value. Quoted strings are
+// always strings; other values are typed according to their text.
+func (b *lineRenderer) evalPropValue(s *stringOrSubst) (Value, error) {
+	str, err := b.evalStringOrSubst(s)
+	if err != nil {
+		return Value{}, err
+	}
+	if s.String != nil || (s.Subst == "" && s.Bare == "") {
+		return StringValue(str), nil
+	}
+	if v, ok := b.substValue(s.Subst); ok {
+		return v, nil
+	}
+	return markupValue(str), nil
+}
+
+// markupValue types an unquoted markup property value.
+func markupValue(s string) Value {
+	switch s {
+	case "true":
+		return BoolValue(true)
+	case "false":
+		return BoolValue(false)
+	}
+	if isMarkupNumber(s) {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return NumberValue(f)
+		}
+	}
+	return StringValue(s)
+}
+
+// isMarkupNumber reports whether s is a number in the markup syntax: an
+// optional minus sign, digits, and optionally a decimal point and more
+// digits.
+func isMarkupNumber(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	i, f, dot := strings.Cut(s, ".")
+	if i == "" || (dot && f == "") {
+		return false
+	}
+	for _, c := range []byte(i + f) {
+		if !isDigit(c) {
+			return false
+		}
+	}
+	return true
+}
+
 // propValueForKey searches f.Props for the option matching the key, and
 // then returns the Value.
 func (b *lineRenderer) propValueForKey(f *parsedMarkupTag, key string) (*stringOrSubst, error) {
@@ -582,14 +833,21 @@ func (b *lineRenderer) propValueForKey(f *parsedMarkupTag, key string) (*stringO
 			return opt.Value, nil
 		}
 	}
-	return nil, fmt.Errorf("key %q not found in %#v", key, f.Props)
+	return nil, fmt.Errorf("%s has no %q property", f.Name, key)
 }
 
 func (b *lineRenderer) renderFormatFuncValue(s *stringOrSubst, input string) error {
 	// Format func values have an additional token that needs to be processed
 	// specially (%).
 	if s.Subst != "" {
-		b.builder.WriteString(b.evalSubst(s.Subst))
+		b.builder.WriteString(b.substText(s.Subst))
+		return nil
+	}
+	if s.Bare != "" {
+		b.builder.WriteString(s.Bare)
+		return nil
+	}
+	if s.String == nil {
 		return nil
 	}
 	for _, v := range s.String.Fragments {
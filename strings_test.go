@@ -15,9 +15,11 @@
 package yarn
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"golang.org/x/text/language"
 )
 
 func TestScanAttribEvents(t *testing.T) {
@@ -86,3 +88,233 @@ func TestScanAttribEvents(t *testing.T) {
 		t.Errorf("ScanAttribEvents scan order diff:\n%s", diff)
 	}
 }
+
+func TestCharacterAttribute(t *testing.T) {
+	tests := []struct {
+		input    string
+		substs   []string
+		wantName string
+		wantOK   bool
+		wantText string
+		wantEnd  int
+	}{
+		{input: "Mae: Hello!", wantName: "Mae", wantOK: true, wantText: "Hello!", wantEnd: 5},
+		{input: "Mae:Hello", wantName: "Mae", wantOK: true, wantText: "Hello", wantEnd: 4},
+		{input: "Old Sam:   Hi", wantName: "Old Sam", wantOK: true, wantText: "Hi", wantEnd: 11},
+		{input: "Mae: Time: 10:30", wantName: "Mae", wantOK: true, wantText: "Time: 10:30", wantEnd: 5},
+		{input: "No character here.", wantText: "No character here."},
+		{input: ": Nobody", wantText: ": Nobody"},
+		{input: `Mae\: not a name`, wantText: "Mae: not a name"},
+		{input: "[nomarkup]Time: 10:30[/nomarkup]", wantText: "Time: 10:30"},
+		{input: "[b]Mae:[/b] Hello", wantName: "Mae", wantOK: true, wantText: "Hello", wantEnd: 5},
+		{input: `[character name="Sam"]Mae: [/character]Hi`, wantName: "Sam", wantOK: true, wantText: "Hi", wantEnd: 5},
+		{input: "{0}: Hello", substs: []string{"Mae"}, wantName: "Mae", wantOK: true, wantText: "Hello", wantEnd: 5},
+		{input: "Hello {0}", substs: []string{"a:b"}, wantText: "Hello a:b"},
+	}
+	for _, test := range tests {
+		row := &StringTableRow{Text: test.input}
+		as, err := row.Render(test.substs, language.English)
+		if err != nil {
+			t.Errorf("Render(%q) = %v", test.input, err)
+			continue
+		}
+		name, ok := as.CharacterName()
+		if name != test.wantName || ok != test.wantOK {
+			t.Errorf("Render(%q).CharacterName() = %q, %t, want %q, %t", test.input, name, ok, test.wantName, test.wantOK)
+		}
+		if got := as.TextWithoutCharacterName(); got != test.wantText {
+			t.Errorf("Render(%q).TextWithoutCharacterName() = %q, want %q", test.input, got, test.wantText)
+		}
+		if a := as.characterAttribute(); a != nil && a.End != test.wantEnd {
+			t.Errorf("Render(%q) character attribute End = %d, want %d", test.input, a.End, test.wantEnd)
+		}
+	}
+}
+
+func TestCharacterAttributeSmileys(t *testing.T) {
+	st, err := LoadStringTableFile("testdata/Smileys-Lines.csv", "en")
+	if err != nil {
+		t.Fatalf("LoadStringTableFile = %v", err)
+	}
+	for id, row := range st.Table {
+		as, err := row.Render(nil, st.Language)
+		if err != nil {
+			t.Errorf("Render(%q) = %v", row.Text, err)
+			continue
+		}
+		if !strings.HasPrefix(as.String(), "Mae: ") {
+			// Not a smiley line (e.g. "Separating the option groups here.")
+			if name, ok := as.CharacterName(); ok {
+				t.Errorf("%s: Render(%q).CharacterName() = %q, want none", id, row.Text, name)
+			}
+			continue
+		}
+		if name, ok := as.CharacterName(); name != "Mae" || !ok {
+			t.Errorf("%s: Render(%q).CharacterName() = %q, %t, want Mae, true", id, row.Text, name, ok)
+		}
+		if got, want := as.TextWithoutCharacterName(), strings.TrimPrefix(as.String(), "Mae: "); got != want {
+			t.Errorf("%s: Render(%q).TextWithoutCharacterName() = %q, want %q", id, row.Text, got, want)
+		}
+	}
+}
+
+// renderMarkup renders input without substitutions, and returns the text and
+// the attributes in the order they were opened.
+func renderMarkup(t *testing.T, input string, substs ...string) (string, []*Attribute) {
+	t.Helper()
+	row := &StringTableRow{Text: input}
+	as, err := row.Render(substs, language.English)
+	if err != nil {
+		t.Fatalf("Render(%q) = %v", input, err)
+	}
+	var atts []*Attribute
+	as.ScanAttribEvents(func(pos int, as []*Attribute) {
+		for _, a := range as {
+			if a.Start == pos {
+				atts = append(atts, a)
+			}
+		}
+	})
+	return as.String(), atts
+}
+
+func TestMarkupSemantics(t *testing.T) {
+	// Cases adapted from Yarn Spinner's markup tests.
+	tests := []struct {
+		input    string
+		substs   []string
+		wantText string
+		wantAtts []*Attribute
+	}{
+		{
+			input:    "A [b]B [c]C[/c][/b]",
+			wantText: "A B C",
+			wantAtts: []*Attribute{
+				{Start: 2, End: 5, Name: "b"},
+				{Start: 4, End: 5, Name: "c"},
+			},
+		},
+		{
+			input:    "S [a]S[/a] [nomarkup][a]S;][/a][/nomarkup]",
+			wantText: "S S [a]S;][/a]",
+			wantAtts: []*Attribute{
+				{Start: 2, End: 3, Name: "a"},
+				{Start: 4, End: 14, Name: "nomarkup"},
+			},
+		},
+		{
+			input:    `[nomarkup]\[not escaped\][/nomarkup]`,
+			wantText: `\[not escaped\]`,
+			wantAtts: []*Attribute{{Start: 0, End: 15, Name: "nomarkup"}},
+		},
+		{
+			input:    `[a]hello \[b\]hello\[/b\][/a]`,
+			wantText: "hello [b]hello[/b]",
+			wantAtts: []*Attribute{{Start: 0, End: 18, Name: "a"}},
+		},
+		{
+			input:    "A [b/] C",
+			wantText: "A C",
+			wantAtts: []*Attribute{{Start: 2, End: 2, Name: "b"}},
+		},
+		{
+			input:    "A [b/]C",
+			wantText: "A C",
+			wantAtts: []*Attribute{{Start: 2, End: 2, Name: "b"}},
+		},
+		{
+			input:    "A[b/] C",
+			wantText: "A C",
+			wantAtts: []*Attribute{{Start: 1, End: 1, Name: "b"}},
+		},
+		{
+			input:    "[b/] A",
+			wantText: "A",
+			wantAtts: []*Attribute{{Start: 0, End: 0, Name: "b"}},
+		},
+		{
+			input:    "A [b trimwhitespace=false/] C",
+			wantText: "A  C",
+			wantAtts: []*Attribute{{Start: 2, End: 2, Name: "b", Props: map[string]Value{
+				"trimwhitespace": BoolValue(false),
+			}}},
+		},
+		{
+			input:    "A[b trimwhitespace=true/] C",
+			wantText: "AC",
+			wantAtts: []*Attribute{{Start: 1, End: 1, Name: "b", Props: map[string]Value{
+				"trimwhitespace": BoolValue(true),
+			}}},
+		},
+		{
+			input:    "A [b/]{0}",
+			substs:   []string{" C"},
+			wantText: "A C",
+			wantAtts: []*Attribute{{Start: 2, End: 2, Name: "b"}},
+		},
+		{
+			input:    "[a=1]s[/a]",
+			wantText: "s",
+			wantAtts: []*Attribute{{Start: 0, End: 1, Name: "a", Props: map[string]Value{
+				"a": NumberValue(1),
+			}}},
+		},
+		{
+			input:    `[a p1=1 p2=-2.5 p3=true p4=false p5=word p6="string" p7="1" p8={0}]s[/a]`,
+			substs:   []string{"3"},
+			wantText: "s",
+			wantAtts: []*Attribute{{Start: 0, End: 1, Name: "a", Props: map[string]Value{
+				"p1": NumberValue(1),
+				"p2": NumberValue(-2.5),
+				"p3": BoolValue(true),
+				"p4": BoolValue(false),
+				"p5": StringValue("word"),
+				"p6": StringValue("string"),
+				"p7": StringValue("1"),
+				"p8": NumberValue(3),
+			}}},
+		},
+		{
+			input:    `[a p="escaped \"string\""]s[/a]`,
+			wantText: "s",
+			wantAtts: []*Attribute{{Start: 0, End: 1, Name: "a", Props: map[string]Value{
+				"p": StringValue(`escaped "string"`),
+			}}},
+		},
+		{
+			input:    "[a][b]s[/ trimwhitespace=false]t",
+			wantText: "st",
+			wantAtts: []*Attribute{
+				{Start: 0, End: 1, Name: "a"},
+				{Start: 0, End: 1, Name: "b"},
+			},
+		},
+		{
+			input:    `[plural value=2 one="% apple" other="% apples"/]`,
+			wantText: "2 apples",
+		},
+	}
+	for _, test := range tests {
+		gotText, gotAtts := renderMarkup(t, test.input, test.substs...)
+		if gotText != test.wantText {
+			t.Errorf("Render(%q).String() = %q, want %q", test.input, gotText, test.wantText)
+		}
+		if diff := cmp.Diff(gotAtts, test.wantAtts); diff != "" {
+			t.Errorf("Render(%q) attributes diff (-got +want):\n%s", test.input, diff)
+		}
+	}
+}
+
+func TestMarkupErrors(t *testing.T) {
+	tests := []string{
+		"[a][/a][/b]",
+		"A [b trimwhitespace=1/] C",
+		"[nomarkup]unterminated",
+	}
+	for _, input := range tests {
+		row := &StringTableRow{Text: input}
+		if _, err := row.Render(nil, language.English); err == nil {
+			t.Errorf("Render(%q) = nil error, want error", input)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+
+	yarnpb "drjosh.dev/yarn/bytecode"
+)
+
+// ValueKind enumerates the kinds of Value.
+type ValueKind uint8
+
+// The kinds of Value, corresponding to the Yarn Spinner types.
+const (
+	NullKind ValueKind = iota
+	BoolKind
+	NumberKind
+	StringKind
+
+	// OpaqueKind holds a Go value of any other type, such as a struct or
+	// pointer returned by a function (see OpaqueValue).
+	OpaqueKind
+)
+
+func (k ValueKind) String() string {
+	switch k {
+	case NullKind:
+		return "null"
+	case BoolKind:
+		return "bool"
+	case NumberKind:
+		return "number"
+	case StringKind:
+		return "string"
+	case OpaqueKind:
+		return "opaque"
+	}
+	return fmt.Sprintf("(invalid ValueKind %d)", k)
+}
+
+// Value is a value of one of the Yarn Spinner types: null, bool, number, or
+// string, or an opaque Go value passed between functions. The zero Value is
+// null. Unlike interface{}, a Value can be copied
+// around (e.g. pushed onto the VM stack) without allocating.
+type Value struct {
+	kind ValueKind
+	num  float64 // used by BoolKind (0 or 1) and NumberKind
+	str  string  // used by StringKind
+	obj  any     // used by OpaqueKind
+	f64  bool    // NumberKind has float64 precision (see NumberValue64)
+}
+
+// NullValue returns the null Value.
+func NullValue() Value { return Value{} }
+
+// BoolValue returns a Value containing a bool.
+func BoolValue(b bool) Value {
+	if b {
+		return Value{kind: BoolKind, num: 1}
+	}
+	return Value{kind: BoolKind}
+}
+
+// NumberValue returns a Value containing a number with float32 precision, as
+// in Yarn Spinner: it is converted to float32 by Interface, and formatted as
+// a float32 by String. (The number itself is not rounded.)
+func NumberValue(n float64) Value { return Value{kind: NumberKind, num: n} }
+
+// NumberValue64 returns a Value containing a number with float64 precision:
+// it is converted to float64 by Interface, and formatted as a float64 by
+// String. A VM in NumericFloat64 mode converts every number it handles to
+// float64 precision, including those from NumberValue.
+func NumberValue64(n float64) Value { return Value{kind: NumberKind, num: n, f64: true} }
+
+// StringValue returns a Value containing a string.
+func StringValue(s string) Value { return Value{kind: StringKind, str: s} }
+
+// OpaqueValue returns a Value wrapping an arbitrary Go value, such as a
+// struct, pointer, or slice. Opaque values can't be converted to numbers, or
+// saved by storages that encode values, but they can be passed from one
+// function to another, stored in variables held in memory, and compared.
+// Functions returning values that ValueOf can't convert produce opaque values.
+func OpaqueValue(x any) Value {
+	if x == nil {
+		return Value{}
+	}
+	return Value{kind: OpaqueKind, obj: x}
+}
+
+// ValueOf converts a Go value into a Value. nil becomes null, bool becomes
+// bool, all the integer and floating-point types become numbers, and strings
+// become strings. A Value is returned as-is. Anything else is an error (use
+// OpaqueValue to wrap other values).
+func ValueOf(x any) (Value, error) {
+	switch x := x.(type) {
+	case nil:
+		return Value{}, nil
+	case Value:
+		return x, nil
+	case bool:
+		return BoolValue(x), nil
+	case float32:
+		return NumberValue(float64(x)), nil
+	case float64:
+		return NumberValue(x), nil
+	case int:
+		return NumberValue(float64(x)), nil
+	case string:
+		return StringValue(x), nil
+	}
+	// Less common types (other int sizes, named types, etc)
+	rv := reflect.ValueOf(x)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return BoolValue(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NumberValue(float64(rv.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return NumberValue(float64(rv.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return NumberValue(rv.Float()), nil
+	case reflect.String:
+		return StringValue(rv.String()), nil
+	}
+	return Value{}, fmt.Errorf("%T %w to Value", x, ErrNotConvertible)
+}
+
+// valueOrOpaque converts x with ValueOf, falling back to OpaqueValue.
+func valueOrOpaque(x any) Value {
+	if v, err := ValueOf(x); err == nil {
+		return v
+	}
+	return OpaqueValue(x)
+}
+
+// valueFromOperand converts an operand into a Value.
+func valueFromOperand(op *yarnpb.Operand) Value {
+	switch x := op.GetValue().(type) {
+	case *yarnpb.Operand_BoolValue:
+		return BoolValue(x.BoolValue)
+	case *yarnpb.Operand_FloatValue:
+		return NumberValue(float64(x.FloatValue))
+	case *yarnpb.Operand_StringValue:
+		return StringValue(x.StringValue)
+	}
+	return Value{}
+}
+
+// Kind returns the kind of value.
+func (v Value) Kind() ValueKind { return v.kind }
+
+// IsNull reports whether v is null.
+func (v Value) IsNull() bool { return v.kind == NullKind }
+
+// Interface returns the value as one of the Go types nil, bool, float32, or
+// string. This is the representation used by VariableStorage and FuncMap.
+// Numbers with float64 precision (see NumberValue64) are float64 instead,
+// and opaque values are returned as-is.
+func (v Value) Interface() any {
+	switch v.kind {
+	case BoolKind:
+		return v.num != 0
+	case NumberKind:
+		if v.f64 {
+			return v.num
+		}
+		return float32(v.num)
+	case StringKind:
+		return v.str
+	case OpaqueKind:
+		return v.obj
+	}
+	return nil
+}
+
+// Bool converts the value to a bool, in the same way as Yarn Spinner: null is
+// false, numbers are true unless zero or NaN, and strings are true unless
+// empty. Opaque values are true.
+func (v Value) Bool() bool {
+	switch v.kind {
+	case BoolKind:
+		return v.num != 0
+	case NumberKind:
+		return !math.IsNaN(v.num) && v.num != 0
+	case StringKind:
+		return v.str != ""
+	case OpaqueKind:
+		return true
+	}
+	return false
+}
+
+// Number converts the value to a number. null is 0, false is 0, true is 1,
+// and strings are parsed with ParseNumber. Opaque values are an error.
+func (v Value) Number() (float64, error) {
+	switch v.kind {
+	case StringKind:
+		return ParseNumber(v.str)
+	case OpaqueKind:
+		return 0, fmt.Errorf("%T %w to number", v.obj, ErrNotConvertible)
+	}
+	return v.num, nil
+}
+
+// Float32 converts the value to a float32. See Number.
+func (v Value) Float32() (float32, error) {
+	switch v.kind {
+	case StringKind:
+		f, err := parseNumber(v.str, 32)
+		return float32(f), err
+	case OpaqueKind:
+		return 0, fmt.Errorf("%T %w to float32", v.obj, ErrNotConvertible)
+	}
+	return float32(v.num), nil
+}
+
+// Int converts the value to an int. Numbers are truncated towards zero, and
+// strings are parsed as numbers (see Number) and then truncated.
+func (v Value) Int() (int, error) {
+	switch v.kind {
+	case StringKind:
+		f, err := ParseNumber(v.str)
+		return int(f), err
+	case OpaqueKind:
+		return 0, fmt.Errorf("%T %w to int", v.obj, ErrNotConvertible)
+	}
+	return int(v.num), nil
+}
+
+// String converts the value to a string, in the same way as ConvertToString.
+// Numbers are formatted as float32, unless they have float64 precision (see
+// NumberValue64). Opaque values are formatted with fmt.Sprint.
+func (v Value) String() string {
+	switch v.kind {
+	case BoolKind:
+		if v.num != 0 {
+			return "True"
+		}
+		return "False"
+	case NumberKind:
+		if v.f64 {
+			return formatNumber(v.num, 64)
+		}
+		return FormatNumber(float32(v.num))
+	case StringKind:
+		return v.str
+	case OpaqueKind:
+		return fmt.Sprint(v.obj)
+	}
+	return "null"
+}
+
+// Equal reports whether v and w are the same kind and have equal values.
+// Opaque values are equal if they have the same comparable type and are equal
+// according to ==.
+func (v Value) Equal(w Value) bool {
+	if v.kind == OpaqueKind && w.kind == OpaqueKind {
+		t := reflect.TypeOf(v.obj)
+		return t == reflect.TypeOf(w.obj) && t.Comparable() && v.obj == w.obj
+	}
+	return v.kind == w.kind && v.num == w.num && v.str == w.str
+}
+
+// Operand converts the value into an operand. Numbers are stored as float32,
+// and null and opaque values become an operand with no value.
+func (v Value) Operand() *yarnpb.Operand {
+	switch v.kind {
+	case BoolKind:
+		return &yarnpb.Operand{Value: &yarnpb.Operand_BoolValue{BoolValue: v.num != 0}}
+	case NumberKind:
+		return &yarnpb.Operand{Value: &yarnpb.Operand_FloatValue{FloatValue: float32(v.num)}}
+	case StringKind:
+		return &yarnpb.Operand{Value: &yarnpb.Operand_StringValue{StringValue: v.str}}
+	}
+	return &yarnpb.Operand{}
+}
+
+// nonFiniteJSON is the JSON encoding of NaN and infinite numbers, which JSON
+// numbers can't represent, for example {"number": "NaN"}. The spelling of the
+// number is the same as FormatNumber. (A plain string would be
+// indistinguishable from a string value.)
+type nonFiniteJSON struct {
+	Number string `json:"number"`
+}
+
+// MarshalJSON encodes the value as a JSON null, boolean, number, or string.
+// NaN and infinite numbers are encoded as an object containing the number as
+// a string, for example {"number": "-Infinity"}.
+func (v Value) MarshalJSON() ([]byte, error) {
+	switch v.kind {
+	case BoolKind:
+		return json.Marshal(v.num != 0)
+	case NumberKind:
+		if math.IsNaN(v.num) || math.IsInf(v.num, 0) {
+			return json.Marshal(nonFiniteJSON{Number: formatNumber(v.num, 64)})
+		}
+		return json.Marshal(v.num)
+	case StringKind:
+		return json.Marshal(v.str)
+	case OpaqueKind:
+		return nil, fmt.Errorf("opaque %T %w to JSON", v.obj, ErrNotConvertible)
+	}
+	return []byte("null"), nil
+}
+
+// UnmarshalJSON decodes a JSON null, boolean, number, or string into the
+// value, as well as NaN and infinite numbers encoded by MarshalJSON.
+func (v *Value) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '{' {
+		var nf nonFiniteJSON
+		if err := json.Unmarshal(b, &nf); err != nil {
+			return err
+		}
+		n, err := ParseNumber(nf.Number)
+		if err != nil {
+			return err
+		}
+		*v = NumberValue(n)
+		return nil
+	}
+	var x any
+	if err := json.Unmarshal(b, &x); err != nil {
+		return err
+	}
+	w, err := ValueOf(x)
+	if err != nil {
+		return err
+	}
+	*v = w
+	return nil
+}
+
+// GobEncode encodes the value for encoding/gob.
+func (v Value) GobEncode() ([]byte, error) {
+	switch v.kind {
+	case BoolKind, NumberKind:
+		return binary.LittleEndian.AppendUint64([]byte{byte(v.kind)}, math.Float64bits(v.num)), nil
+	case StringKind:
+		return append([]byte{byte(v.kind)}, v.str...), nil
+	case OpaqueKind:
+		return nil, fmt.Errorf("opaque %T %w to gob", v.obj, ErrNotConvertible)
+	}
+	return []byte{byte(NullKind)}, nil
+}
+
+// GobDecode decodes a value encoded with GobEncode.
+func (v *Value) GobDecode(b []byte) error {
+	if len(b) == 0 {
+		return fmt.Errorf("%w: empty gob-encoded Value", ErrWrongType)
+	}
+	switch k := ValueKind(b[0]); k {
+	case NullKind:
+		*v = Value{}
+	case BoolKind, NumberKind:
+		if len(b) != 9 {
+			return fmt.Errorf("%w: gob-encoded %v has length %d", ErrWrongType, k, len(b))
+		}
+		*v = Value{kind: k, num: math.Float64frombits(binary.LittleEndian.Uint64(b[1:]))}
+	case StringKind:
+		*v = StringValue(string(b[1:]))
+	default:
+		return fmt.Errorf("%w: gob-encoded Value has invalid kind %d", ErrWrongType, b[0])
+	}
+	return nil
+}
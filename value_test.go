@@ -0,0 +1,242 @@
+// Copyright 2026 Josh Deprez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yarn
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	yarnpb "drjosh.dev/yarn/bytecode"
+)
+
+func TestValueOf(t *testing.T) {
+	type myString string
+	tests := []struct {
+		input any
+		want  Value
+	}{
+		{nil, NullValue()},
+		{true, BoolValue(true)},
+		{float32(1.5), NumberValue(1.5)},
+		{float64(2.5), NumberValue(2.5)},
+		{int(3), NumberValue(3)},
+		{int64(-4), NumberValue(-4)},
+		{uint8(5), NumberValue(5)},
+		{"hi", StringValue("hi")},
+		{myString("named"), StringValue("named")},
+		{StringValue("already"), StringValue("already")},
+	}
+	for _, test := range tests {
+		got, err := ValueOf(test.input)
+		if err != nil {
+			t.Errorf("ValueOf(%#v) error = %v", test.input, err)
+			continue
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("ValueOf(%#v) = %#v, want %#v", test.input, got, test.want)
+		}
+	}
+
+	if _, err := ValueOf(struct{}{}); !errors.Is(err, ErrNotConvertible) {
+		t.Errorf("ValueOf(struct{}{}) error = %v, want %v", err, ErrNotConvertible)
+	}
+}
+
+func TestValueConversions(t *testing.T) {
+	tests := []struct {
+		v      Value
+		bool   bool
+		num    float64
+		numErr bool
+		str    string
+	}{
+		{NullValue(), false, 0, false, "null"},
+		{BoolValue(true), true, 1, false, "True"},
+		{BoolValue(false), false, 0, false, "False"},
+		{NumberValue(0), false, 0, false, "0"},
+		{NumberValue(2.5), true, 2.5, false, "2.5"},
+		{NumberValue(math.NaN()), false, math.NaN(), false, "NaN"},
+		{StringValue(""), false, 0, true, ""},
+		{StringValue("4.25"), true, 4.25, false, "4.25"},
+		{OpaqueValue(testItem{Name: "sword"}), true, 0, true, "{sword}"},
+	}
+	for _, test := range tests {
+		if got := test.v.Bool(); got != test.bool {
+			t.Errorf("%#v.Bool() = %t, want %t", test.v, got, test.bool)
+		}
+		got, err := test.v.Number()
+		if (err != nil) != test.numErr {
+			t.Errorf("%#v.Number() error = %v, want error %t", test.v, err, test.numErr)
+		}
+		if err == nil && got != test.num && !(math.IsNaN(got) && math.IsNaN(test.num)) {
+			t.Errorf("%#v.Number() = %v, want %v", test.v, got, test.num)
+		}
+		if got := test.v.String(); got != test.str {
+			t.Errorf("%#v.String() = %q, want %q", test.v, got, test.str)
+		}
+		if got := ConvertToString(test.v.Interface()); got != test.str {
+			t.Errorf("ConvertToString(%#v.Interface()) = %q, want %q", test.v, got, test.str)
+		}
+	}
+}
+
+// testItem is a Go type that isn't one of the Yarn Spinner types.
+type testItem struct{ Name string }
+
+func TestOpaqueFunctionResults(t *testing.T) {
+	// $result = item_name(make_item("sword"))
+	node := &yarnpb.Node{
+		Name: "Start",
+		Instructions: []*yarnpb.Instruction{
+			{Opcode: yarnpb.Instruction_PUSH_STRING, Operands: []*yarnpb.Operand{StringValue("sword").Operand()}},
+			{Opcode: yarnpb.Instruction_PUSH_FLOAT, Operands: []*yarnpb.Operand{NumberValue(1).Operand()}},
+			{Opcode: yarnpb.Instruction_CALL_FUNC, Operands: []*yarnpb.Operand{StringValue("make_item").Operand()}},
+			{Opcode: yarnpb.Instruction_STORE_VARIABLE, Operands: []*yarnpb.Operand{StringValue("$item").Operand()}},
+			{Opcode: yarnpb.Instruction_PUSH_FLOAT, Operands: []*yarnpb.Operand{NumberValue(1).Operand()}},
+			{Opcode: yarnpb.Instruction_CALL_FUNC, Operands: []*yarnpb.Operand{StringValue("item_name").Operand()}},
+			{Opcode: yarnpb.Instruction_STORE_VARIABLE, Operands: []*yarnpb.Operand{StringValue("$result").Operand()}},
+			{Opcode: yarnpb.Instruction_STOP},
+		},
+	}
+	item := &testItem{}
+	vars := NewMapVariableStorage()
+	vm := &VirtualMachine{
+		Program: &yarnpb.Program{Nodes: map[string]*yarnpb.Node{"Start": node}},
+		Handler: FakeDialogueHandler{},
+		Vars:    vars,
+		FuncMap: FuncMap{
+			"make_item": func(name string) *testItem {
+				item.Name = name
+				return item
+			},
+			"item_name": func(it *testItem) string { return it.Name },
+		},
+	}
+	if err := vm.Run("Start"); err != nil {
+		t.Fatalf("vm.Run(Start) = %v", err)
+	}
+	if got, _ := vars.GetValue("$item"); got != item {
+		t.Errorf("$item = %v, want %v", got, item)
+	}
+	if got, _ := vars.GetValue("$result"); got != "sword" {
+		t.Errorf("$result = %v, want sword", got)
+	}
+	if v := OpaqueValue(item); !v.Equal(OpaqueValue(item)) || v.Equal(OpaqueValue(&testItem{})) {
+		t.Errorf("OpaqueValue(%p).Equal gave wrong result", item)
+	}
+	if _, err := OpaqueValue(item).MarshalJSON(); !errors.Is(err, ErrNotConvertible) {
+		t.Errorf("OpaqueValue(item).MarshalJSON() error = %v, want %v", err, ErrNotConvertible)
+	}
+}
+
+func TestTypedMapVariableStorage(t *testing.T) {
+	s := NewTypedMapVariableStorage()
+	s.SetValue("$num", 3)
+	s.SetTypedValue("$str", StringValue("x"))
+	s.SetValue("$other", struct{}{})
+
+	if got, ok := s.GetTypedValue("$num"); !ok || !got.Equal(NumberValue(3)) {
+		t.Errorf("GetTypedValue($num) = %v, %t, want 3, true", got, ok)
+	}
+	if got, ok := s.GetValue("$str"); !ok || got != "x" {
+		t.Errorf("GetValue($str) = %v, %t, want x, true", got, ok)
+	}
+	if _, ok := s.GetTypedValue("$other"); ok {
+		t.Error("GetTypedValue($other) ok = true, want false")
+	}
+	if got, ok := s.GetValue("$other"); !ok || got != (struct{}{}) {
+		t.Errorf("GetValue($other) = %v, %t, want struct{}{}, true", got, ok)
+	}
+
+	s.Delete("$num", "$other")
+	if got, want := len(s.Contents()), 1; got != want {
+		t.Errorf("len(Contents()) = %d, want %d", got, want)
+	}
+}
+
+func TestAllTestPlansTypedStorage(t *testing.T) {
+	for _, base := range []string{"Expressions", "VariableStorage", "VisitCount", "Types"} {
+		t.Run(base, func(t *testing.T) {
+			runTestPlan(t, base, NewTypedMapVariableStorage(), NumericFloat32)
+		})
+	}
+}
+
+// loopProgram returns a program that pushes, stores, and loads a variable n
+// times, without calling any functions or delivering any lines.
+func loopProgram(n int) *yarnpb.Program {
+	str := func(s string) *yarnpb.Operand {
+		return &yarnpb.Operand{Value: &yarnpb.Operand_StringValue{StringValue: s}}
+	}
+	node := &yarnpb.Node{Name: "Start"}
+	for i := 0; i < n; i++ {
+		node.Instructions = append(node.Instructions,
+			&yarnpb.Instruction{
+				Opcode:   yarnpb.Instruction_PUSH_FLOAT,
+				Operands: []*yarnpb.Operand{{Value: &yarnpb.Operand_FloatValue{FloatValue: float32(i)}}},
+			},
+			&yarnpb.Instruction{Opcode: yarnpb.Instruction_STORE_VARIABLE, Operands: []*yarnpb.Operand{str("$x")}},
+			&yarnpb.Instruction{Opcode: yarnpb.Instruction_POP},
+			&yarnpb.Instruction{Opcode: yarnpb.Instruction_PUSH_VARIABLE, Operands: []*yarnpb.Operand{str("$x")}},
+			&yarnpb.Instruction{Opcode: yarnpb.Instruction_PUSH_BOOL, Operands: []*yarnpb.Operand{{Value: &yarnpb.Operand_BoolValue{BoolValue: true}}}},
+			&yarnpb.Instruction{Opcode: yarnpb.Instruction_POP},
+			&yarnpb.Instruction{Opcode: yarnpb.Instruction_POP},
+		)
+	}
+	node.Instructions = append(node.Instructions, &yarnpb.Instruction{Opcode: yarnpb.Instruction_STOP})
+	return &yarnpb.Program{Nodes: map[string]*yarnpb.Node{"Start": node}}
+}
+
+func BenchmarkInstructionLoop(b *testing.B) {
+	prog := loopProgram(100)
+	storages := []struct {
+		name string
+		new  func() VariableStorage
+	}{
+		{"MapVariableStorage", func() VariableStorage { return NewMapVariableStorage() }},
+		{"TypedMapVariableStorage", func() VariableStorage { return NewTypedMapVariableStorage() }},
+	}
+	for _, s := range storages {
+		b.Run(s.name, func(b *testing.B) {
+			vm := &VirtualMachine{
+				Program: prog,
+				Handler: FakeDialogueHandler{},
+				Vars:    s.new(),
+			}
+			b.ReportAllocs()
+			for b.Loop() {
+				if err := vm.Run("Start"); err != nil {
+					b.Fatalf("vm.Run(Start) = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkStackPushPop(b *testing.B) {
+	var s state
+	b.ReportAllocs()
+	for b.Loop() {
+		s.push(NumberValue(1))
+		s.push(StringValue("x"))
+		s.push(BoolValue(true))
+		for range 3 {
+			if _, err := s.pop(); err != nil {
+				b.Fatalf("pop() = %v", err)
+			}
+		}
+	}
+}
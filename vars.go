@@ -22,6 +22,45 @@ type VariableStorage interface {
 	SetValue(name string, value any)
 }
 
+// FlushableVariableStorage is an optional interface for VariableStorage
+// implementations that buffer writes (for example, to write them to a
+// database in batches). If the VM's Vars implements FlushableVariableStorage,
+// the VM calls Flush when each node is complete (before calling the handler's
+// NodeComplete), and when the dialogue is complete (before calling the
+// handler's DialogueComplete).
+type FlushableVariableStorage interface {
+	VariableStorage
+	Flush() error
+}
+
+// FallibleVariableStorage is an optional interface for VariableStorage
+// implementations whose operations can fail, since GetValue and SetValue
+// cannot return errors. If the VM's Vars implements FallibleVariableStorage,
+// the VM calls Err after each PUSH_VARIABLE and STORE_VARIABLE instruction,
+// and stops with the error if it is not nil.
+//
+// Errors are sticky: once an operation has failed, Err keeps returning the
+// first error, and calling Err does not clear it. Implementations that can
+// recover provide their own way to clear the error (for example,
+// SQLVariableStorage.Load and ComputedVariableStorage.ClearErr).
+type FallibleVariableStorage interface {
+	VariableStorage
+
+	// Err returns the first error from a previous operation that failed,
+	// otherwise nil.
+	Err() error
+}
+
+// TypedVariableStorage is an optional interface for VariableStorage
+// implementations that can store Values directly. If the VM's Vars implements
+// TypedVariableStorage, the VM uses GetTypedValue and SetTypedValue instead of
+// GetValue and SetValue, which avoids converting values to and from any.
+type TypedVariableStorage interface {
+	VariableStorage
+	GetTypedValue(name string) (value Value, ok bool)
+	SetTypedValue(name string, value Value)
+}
+
 // MapVariableStorage implements VariableStorage, in memory, using a map.
 // In addition to the core VariableStorage functionality, there are methods for
 // accessing the contents as an ordinary map[string]any.
@@ -106,6 +145,94 @@ func (m *MapVariableStorage) ReplaceContents(src map[string]any) {
 	m.m = m2
 }
 
+// TypedMapVariableStorage implements TypedVariableStorage, in memory, using a
+// map of Values. Values set using SetValue that are not convertible to Value
+// (see ValueOf) are kept in a separate map, so that GetValue can still return
+// them.
+type TypedMapVariableStorage struct {
+	mu    sync.RWMutex
+	m     map[string]Value
+	other map[string]any // lazily created
+}
+
+// NewTypedMapVariableStorage creates a new empty TypedMapVariableStorage.
+func NewTypedMapVariableStorage() *TypedMapVariableStorage {
+	return &TypedMapVariableStorage{
+		m: make(map[string]Value),
+	}
+}
+
+// Clear empties the storage of all values.
+func (m *TypedMapVariableStorage) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.m = make(map[string]Value)
+	m.other = nil
+}
+
+// GetTypedValue fetches a value from the storage, returning (null, false) if
+// not present or not a Value.
+func (m *TypedMapVariableStorage) GetTypedValue(name string) (value Value, found bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	value, found = m.m[name]
+	return value, found
+}
+
+// SetTypedValue sets a value in the storage.
+func (m *TypedMapVariableStorage) SetTypedValue(name string, value Value) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.m[name] = value
+	delete(m.other, name)
+}
+
+// GetValue fetches a value from the storage, returning (nil, false) if not
+// present. Values are returned using Value.Interface.
+func (m *TypedMapVariableStorage) GetValue(name string) (value any, found bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if v, found := m.m[name]; found {
+		return v.Interface(), true
+	}
+	value, found = m.other[name]
+	return value, found
+}
+
+// SetValue sets a value in the storage.
+func (m *TypedMapVariableStorage) SetValue(name string, value any) {
+	v, err := ValueOf(value)
+	if err != nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.other == nil {
+			m.other = make(map[string]any)
+		}
+		m.other[name] = value
+		delete(m.m, name)
+		return
+	}
+	m.SetTypedValue(name, v)
+}
+
+// Delete deletes values from the storage.
+func (m *TypedMapVariableStorage) Delete(names ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, name := range names {
+		delete(m.m, name)
+		delete(m.other, name)
+	}
+}
+
+// Contents returns a copy of the Values in the storage, as a regular map.
+// Values that are not convertible to Value are not included.
+func (m *TypedMapVariableStorage) Contents() map[string]Value {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return copyMap(m.m)
+}
+
 func copyMap[K comparable, V any](src map[K]V) map[K]V {
 	m := make(map[K]V, len(src))
 	for name, val := range src {
@@ -18,9 +18,11 @@
 package yarn // import "drjosh.dev/yarn"
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
+	"slices"
 	"strings"
 
 	yarnpb "drjosh.dev/yarn/bytecode"
@@ -72,8 +74,33 @@ const (
 	// ErrFunctionArgMismatch indicates the program tried to call a function but
 	// had the wrong number or types of args to pass to it.
 	ErrFunctionArgMismatch = virtualMachineError("arg mismatch")
+
+	// ErrOptionUnavailable indicates the handler selected an option that is
+	// not available (see RejectUnavailableOptions).
+	ErrOptionUnavailable = virtualMachineError("option unavailable")
+
+	// ErrReadOnlyVariable indicates the program tried to store a value in a
+	// read-only variable (see ComputedVariableStorage).
+	ErrReadOnlyVariable = virtualMachineError("read-only variable")
+
+	// ErrUndeclaredVariable indicates the program used a variable that was
+	// not declared (in Strict mode).
+	ErrUndeclaredVariable = virtualMachineError("undeclared variable")
+
+	// ErrImplicitConversion indicates the program passed a value of one type
+	// to a function parameter of a different type (in Strict mode).
+	ErrImplicitConversion = virtualMachineError("implicit conversion")
+
+	// ErrNullValue indicates the program passed a null value as a function
+	// argument or a substitution (in Strict mode).
+	ErrNullValue = virtualMachineError("null value")
 )
 
+// VisitCountVariablePrefix is the prefix of the variables used to track how
+// many times each node has been visited. The rest of the variable name is the
+// node name.
+const VisitCountVariablePrefix = "$Yarn.Internal.Visiting."
+
 // Stop stops the virtual machine without error. It is used by the STOP
 // instruction, but can also be returned by your handler to stop the VM in the
 // same way. However a stop happens, NodeComplete and DialogueComplete are still
@@ -90,6 +117,11 @@ var (
 	float64Type = reflect.TypeOf(float64(0))
 	intType     = reflect.TypeOf(int(0))
 	stringType  = reflect.TypeOf("")
+	valueType   = reflect.TypeOf(Value{})
+
+	// Used to recognise functions that want a context.
+	contextType     = reflect.TypeOf((*context.Context)(nil)).Elem()
+	callContextType = reflect.TypeOf((*CallContext)(nil))
 )
 
 // Used to implement the sentinel errors as consts instead of vars.
@@ -108,14 +140,77 @@ type VirtualMachine struct {
 	// Vars stores variables used and provided by the dialogue.
 	Vars VariableStorage
 
-	// FuncMap is used to provide user-defined functions.
+	// FuncMap is used to provide user-defined functions. Each function is
+	// converted (see Library.Register) the first time the program calls it,
+	// so unsupported functions are only an error if they are called. New
+	// code should use Library instead.
 	FuncMap FuncMap
 
+	// Library is used to provide user-defined functions. Functions in
+	// Library take precedence over those in FuncMap, which take precedence
+	// over the built-in functions.
+	Library *Library
+
+	// StringTable, if not nil, is used to add metadata (tags and the
+	// character name) to lines and options delivered to Handler.
+	StringTable *StringTable
+
+	// Commands is used to provide commands implemented in Go, which are run
+	// by the VM rather than being delivered to Handler. See CommandMap.
+	Commands CommandMap
+
+	// Clock is used by time-based commands such as wait. If nil, SystemClock
+	// is used.
+	Clock Clock
+
+	// Session holds arbitrary values associated with the dialogue session
+	// (for example, the player's inventory), for use by functions that have
+	// a *CallContext parameter.
+	Session map[string]any
+
+	// Strict, if true, makes the VM enforce Yarn Spinner's type rules,
+	// instead of converting values leniently. In strict mode, the VM stops
+	// with an error when the program:
+	//   - reads or stores a variable not declared in Program.InitialValues
+	//     (ErrUndeclaredVariable),
+	//   - stores a value of a different type to the variable's declaration
+	//     (ErrWrongType),
+	//   - passes a function argument of a different type to the parameter,
+	//     compares or adds values of different types with the untyped
+	//     operators (EqualTo, NotEqualTo, Add), or branches on a value that
+	//     isn't a bool (ErrImplicitConversion), or
+	//   - passes null as a function argument or line substitution
+	//     (ErrNullValue).
+	// This is intended for catching bugs in content during testing.
+	Strict bool
+
+	// OptionPolicy controls how options that are not available (because
+	// their condition was false) are handled. The zero value delivers all
+	// options to the handler, and allows any of them to be selected.
+	OptionPolicy OptionPolicy
+
+	// NumericMode selects the precision of numbers: NumericFloat32 (the
+	// default, matching Yarn Spinner) or NumericFloat64.
+	NumericMode NumericMode
+
+	// Transactional, if true, makes RunContext run the dialogue in a
+	// transaction: variables written by the dialogue are kept in a
+	// LayeredVariableStorage over Vars, and are only committed to Vars when
+	// the dialogue is complete (before calling the handler's
+	// DialogueComplete). If RunContext returns an error before then (for
+	// example, if the handler returns an error, or the context is cancelled,
+	// or an AsyncAdapter is aborted), the writes are discarded, and the
+	// handler's DialogueComplete is not called (even for ErrNoOptions).
+	Transactional bool
+
 	// TraceLogf, if not nil, is called before each instruction to log the
 	// current stack, options, and the instruction about to be executed.
 	TraceLogf func(string, ...interface{})
 
-	state state
+	state    state
+	ctx      context.Context // set during RunContext
+	funcMap  *Library        // functions from FuncMap converted so far
+	builtins *Library        // functions that use the VM, like visited
 }
 
 // SetNode sets the VM to begin a node. If a node is already selected,
@@ -133,6 +228,9 @@ func (vm *VirtualMachine) SetNode(name string) error {
 
 	// Designate the current node complete.
 	if vm.state.node != nil {
+		if err := vm.flushVars(); err != nil {
+			return err
+		}
 		if err := vm.Handler.NodeComplete(vm.state.node.Name); err != nil {
 			return fmt.Errorf("handler.NodeComplete: %w", err)
 		}
@@ -141,6 +239,7 @@ func (vm *VirtualMachine) SetNode(name string) error {
 	// Reset the state and start at this node.
 	vm.state = state{
 		node: node,
+		f64:  vm.NumericMode == NumericFloat64,
 	}
 
 	if err := vm.Handler.NodeStart(name); err != nil {
@@ -163,14 +262,31 @@ func (vm *VirtualMachine) SetNode(name string) error {
 
 // Run executes the program, starting at a particular node.
 func (vm *VirtualMachine) Run(startNode string) error {
+	return vm.RunContext(context.Background(), startNode)
+}
+
+// RunContext executes the program, starting at a particular node. If ctx is
+// cancelled, execution stops before the next instruction, and any command
+// being run from Commands (such as wait) is cancelled.
+func (vm *VirtualMachine) RunContext(ctx context.Context, startNode string) error {
 	if vm.Handler == nil {
 		return ErrNilDialogueHandler
 	}
 	if vm.Vars == nil {
 		return ErrNilVariableStorage
 	}
-	// Provide default funcs, merge provided funcmap to allow overrides.
-	vm.FuncMap = vm.defaultFuncMap().merge(vm.FuncMap)
+	vm.funcMap = NewLibrary()
+	if vm.builtins == nil {
+		vm.builtins = vm.builtinLibrary()
+	}
+	vm.ctx = ctx
+	defer func() { vm.ctx = nil }()
+	var tx *LayeredVariableStorage
+	if vm.Transactional {
+		tx = NewLayeredVariableStorage(vm.Vars)
+		vm.Vars = tx
+		defer func() { vm.Vars = tx.Base() }()
+	}
 	// Set start node
 	if err := vm.SetNode(startNode); err != nil {
 		return err
@@ -178,6 +294,9 @@ func (vm *VirtualMachine) Run(startNode string) error {
 	// Run! This is the instruction loop.
 instructionLoop:
 	for vm.state.pc < len(vm.state.node.Instructions) {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("%s %06d: %w", vm.state.node.Name, vm.state.pc, context.Cause(ctx))
+		}
 		inst := vm.state.node.Instructions[vm.state.pc]
 		if vm.TraceLogf != nil {
 			vm.TraceLogf("stack %v; options %v", vm.state.stack, vm.state.options)
@@ -190,31 +309,93 @@ instructionLoop:
 			return fmt.Errorf("%s %06d %s: %w", vm.state.node.Name, vm.state.pc, FormatInstruction(inst), err)
 		}
 	}
+	if err := vm.flushVars(); err != nil {
+		return err
+	}
 	if err := vm.Handler.NodeComplete(vm.state.node.Name); err != nil && !errors.Is(err, Stop) {
 		return fmt.Errorf("handler.NodeComplete: %w", err)
 	}
+	if tx != nil {
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("vars.Commit: %w", err)
+		}
+		vm.Vars = tx.Base()
+	}
+	if err := vm.flushVars(); err != nil {
+		return err
+	}
 	if err := vm.Handler.DialogueComplete(); err != nil && !errors.Is(err, Stop) {
 		return fmt.Errorf("handler.DialogueComplete: %w", err)
 	}
 	return nil
 }
 
-// defaultFuncMap provides the default func map for this VM along with all built-in functions.
-func (vm *VirtualMachine) defaultFuncMap() FuncMap {
-	result := defaultFuncMap()
-	result.merge(map[string]interface{}{
-		"visited": func(nodeName string) bool {
-			_, ok := vm.Vars.GetValue(fmt.Sprintf("$Yarn.Internal.Visiting.%s", nodeName))
-			return ok
-		},
-		"visited_count": func(nodeName string) int {
-			if count, ok := vm.Vars.GetValue(fmt.Sprintf("$Yarn.Internal.Visiting.%s", nodeName)); ok {
-				return int(count.(float32))
-			}
-			return 0
-		},
+// builtinLibrary provides the built-in functions that need access to the VM.
+func (vm *VirtualMachine) builtinLibrary() *Library {
+	l := NewLibrary()
+	Register1(l, "visited", func(nodeName string) bool {
+		_, ok := vm.Vars.GetValue(VisitCountVariablePrefix + nodeName)
+		return ok
 	})
-	return result
+	Register1(l, "visited_count", func(nodeName string) int {
+		if count, ok := vm.Vars.GetValue(VisitCountVariablePrefix + nodeName); ok {
+			n, _ := ConvertToInt(count)
+			return n
+		}
+		return 0
+	})
+	return l
+}
+
+// lookupFunc finds a function by name, in Library, FuncMap, or the built-in
+// functions (in that order of precedence). It returns nil if there is no such
+// function, and an error if the function in FuncMap is unsupported.
+func (vm *VirtualMachine) lookupFunc(name string) (*function, error) {
+	if f := vm.Library.lookup(name); f != nil {
+		return f, nil
+	}
+	if f := vm.funcMap.lookup(name); f != nil {
+		return f, nil
+	}
+	if x, ok := vm.FuncMap[name]; ok {
+		if err := vm.funcMap.Register(name, x); err != nil {
+			return nil, fmt.Errorf("FuncMap: %w", err)
+		}
+		return vm.funcMap.lookup(name), nil
+	}
+	if f := vm.builtins.lookup(name); f != nil {
+		return f, nil
+	}
+	if vm.NumericMode == NumericFloat64 {
+		if f := defaultLibrary64().lookup(name); f != nil {
+			return f, nil
+		}
+	}
+	return defaultLibrary().lookup(name), nil
+}
+
+// flushVars flushes Vars, if it is a FlushableVariableStorage.
+func (vm *VirtualMachine) flushVars() error {
+	fv, ok := vm.Vars.(FlushableVariableStorage)
+	if !ok {
+		return nil
+	}
+	if err := fv.Flush(); err != nil {
+		return fmt.Errorf("vars.Flush: %w", err)
+	}
+	return nil
+}
+
+// varsErr returns the error from Vars, if it is a FallibleVariableStorage.
+func (vm *VirtualMachine) varsErr() error {
+	fv, ok := vm.Vars.(FallibleVariableStorage)
+	if !ok {
+		return nil
+	}
+	if err := fv.Err(); err != nil {
+		return fmt.Errorf("vars.Err: %w", err)
+	}
+	return nil
 }
 
 func (vm *VirtualMachine) execute(inst *yarnpb.Instruction) error {
@@ -289,12 +470,16 @@ func (vm *VirtualMachine) execRunLine(operands []*yarnpb.Operand) error {
 		if err != nil {
 			return fmt.Errorf("operandToInt(opB): %w", err)
 		}
-		ss, err := vm.state.popNStrings(n)
+		ss, vs, err := vm.popSubstitutions(n)
 		if err != nil {
-			return fmt.Errorf("popNStrings(%d): %w", n, err)
+			return fmt.Errorf("popSubstitutions(%d): %w", n, err)
 		}
-		line.Substitutions = ss
+		line.Substitutions, line.Values = ss, vs
+	}
+	if err := vm.addMetadata(&line); err != nil {
+		return err
 	}
+	vm.setLastLine(line)
 	if err := vm.Handler.Line(line); err != nil {
 		return fmt.Errorf("handler.Line: %w", err)
 	}
@@ -313,7 +498,7 @@ func (vm *VirtualMachine) execRunCommand(operands []*yarnpb.Operand) error {
 		if err != nil {
 			return fmt.Errorf("operandToInt(opB): %w", err)
 		}
-		ss, err := vm.state.popNStrings(n)
+		ss, err := vm.popNStrings(n)
 		if err != nil {
 			return fmt.Errorf("popNStrings(%d): %w", n, err)
 		}
@@ -323,6 +508,14 @@ func (vm *VirtualMachine) execRunCommand(operands []*yarnpb.Operand) error {
 	}
 	// To allow the command to overwrite PC, increment it first
 	vm.state.pc++
+	if words := SplitCommand(cmd); len(words) > 0 {
+		if f := vm.lookupCommand(words[0]); f != nil {
+			if err := vm.runCommandFunc(f, words[1:]); err != nil {
+				return fmt.Errorf("command %q: %w", words[0], err)
+			}
+			return nil
+		}
+	}
 	if err := vm.Handler.Command(cmd); err != nil {
 		return fmt.Errorf("handler.Command: %w", err)
 	}
@@ -346,11 +539,11 @@ func (vm *VirtualMachine) execAddOption(operands []*yarnpb.Operand) error {
 		if err != nil {
 			return fmt.Errorf("operandToInt(opC): %w", err)
 		}
-		ss, err := vm.state.popNStrings(n)
+		ss, vs, err := vm.popSubstitutions(n)
 		if err != nil {
-			return fmt.Errorf("popNStrings(%d): %w", n, err)
+			return fmt.Errorf("popSubstitutions(%d): %w", n, err)
 		}
-		line.Substitutions = ss
+		line.Substitutions, line.Values = ss, vs
 	}
 	avail := true
 	if len(operands) > 3 && operands[3].GetBoolValue() {
@@ -361,11 +554,15 @@ func (vm *VirtualMachine) execAddOption(operands []*yarnpb.Operand) error {
 		}
 		avail = cp
 	}
+	if err := vm.addMetadata(&line); err != nil {
+		return err
+	}
 	vm.state.options = append(vm.state.options, Option{
 		ID:              len(vm.state.options),
 		Line:            line,
 		DestinationNode: operands[1].GetStringValue(),
 		IsAvailable:     avail,
+		LastLine:        vm.state.lastLine,
 	})
 	vm.state.pc++
 	return nil
@@ -377,27 +574,61 @@ func (vm *VirtualMachine) execShowOptions([]*yarnpb.Operand) error {
 	// of the stack when execution resumes.
 	// No operands.
 	if len(vm.state.options) == 0 {
-		// NOTE: jon implements this as a machine stop instead of an exception
-		vm.Handler.DialogueComplete()
+		// NOTE: jon implements this as a machine stop instead of an exception.
+		// In a transaction, the dialogue's writes are about to be discarded,
+		// so the dialogue isn't reported as complete.
+		if !vm.Transactional {
+			vm.Handler.DialogueComplete()
+		}
 		return ErrNoOptions
 	}
-	index, err := vm.Handler.Options(vm.state.options)
+	opts := vm.state.options
+	if vm.OptionPolicy&FilterUnavailableOptions != 0 {
+		opts = availableOptions(opts)
+	}
+	if vm.OptionPolicy&SkipUnavailableOptions != 0 && !anyAvailable(opts) {
+		return vm.skipOptions()
+	}
+	if len(opts) == 0 {
+		return fmt.Errorf("%w: all options are unavailable", ErrNoOptions)
+	}
+	index, err := vm.Handler.Options(opts)
 	if err != nil {
 		return fmt.Errorf("handler.Options: %w", err)
 	}
-	if optslen := len(vm.state.options); index < 0 || index >= optslen {
+	if optslen := len(opts); index < 0 || index >= optslen {
 		return fmt.Errorf("selected option %d out of bounds [0, %d)", index, optslen)
 	}
-	vm.state.push(vm.state.options[index].DestinationNode)
+	if !opts[index].IsAvailable && vm.OptionPolicy&RejectUnavailableOptions != 0 {
+		return fmt.Errorf("%w: selected option %d", ErrOptionUnavailable, index)
+	}
+	vm.state.push(StringValue(opts[index].DestinationNode))
 	vm.state.options = nil
+	vm.state.lastLine = nil
 	vm.state.pc++
 	return nil
 }
 
+// skipOptions continues execution after the end of the current options
+// block, as if an option with no content had been selected.
+func (vm *VirtualMachine) skipOptions() error {
+	end, err := optionsBlockEnd(vm.state.node, vm.state.pc)
+	if err != nil {
+		return err
+	}
+	// The end of the block pops the destination that would have been used
+	// to jump to the selected option.
+	vm.state.push(StringValue(""))
+	vm.state.options = nil
+	vm.state.lastLine = nil
+	vm.state.pc = end
+	return nil
+}
+
 func (vm *VirtualMachine) execPushString(operands []*yarnpb.Operand) error {
 	// Pushes a string onto the stack.
 	// opA = string: the string to push to the stack.
-	vm.state.push(operands[0].GetStringValue())
+	vm.state.push(StringValue(operands[0].GetStringValue()))
 	vm.state.pc++
 	return nil
 }
@@ -405,7 +636,7 @@ func (vm *VirtualMachine) execPushString(operands []*yarnpb.Operand) error {
 func (vm *VirtualMachine) execPushFloat(operands []*yarnpb.Operand) error {
 	// Pushes a floating point number onto the stack.
 	// opA = float: number to push to stack
-	vm.state.push(operands[0].GetFloatValue())
+	vm.state.push(vm.literal(operands[0]))
 	vm.state.pc++
 	return nil
 }
@@ -413,7 +644,7 @@ func (vm *VirtualMachine) execPushFloat(operands []*yarnpb.Operand) error {
 func (vm *VirtualMachine) execPushBool(operands []*yarnpb.Operand) error {
 	// Pushes a boolean onto the stack.
 	// opA = bool: the bool to push to stack
-	vm.state.push(operands[0].GetBoolValue())
+	vm.state.push(BoolValue(operands[0].GetBoolValue()))
 	vm.state.pc++
 	return nil
 }
@@ -421,7 +652,7 @@ func (vm *VirtualMachine) execPushBool(operands []*yarnpb.Operand) error {
 func (vm *VirtualMachine) execPushNull([]*yarnpb.Operand) error {
 	// Pushes a null value onto the stack.
 	// No operands.
-	vm.state.push(nil)
+	vm.state.push(Value{})
 	vm.state.pc++
 	return nil
 }
@@ -434,11 +665,10 @@ func (vm *VirtualMachine) execJumpIfFalse(operands []*yarnpb.Operand) error {
 	if err != nil {
 		return fmt.Errorf("peek: %w", err)
 	}
-	b, err := ConvertToBool(x)
-	if err != nil {
-		return fmt.Errorf("convertToBool: %w", err)
+	if vm.Strict && x.Kind() != BoolKind {
+		return fmt.Errorf("condition: %w from %v to bool", ErrImplicitConversion, x.Kind())
 	}
-	if b {
+	if x.Bool() {
 		// Value is true, so don't jump
 		vm.state.pc++
 		return nil
@@ -467,125 +697,49 @@ func (vm *VirtualMachine) execCallFunc(operands []*yarnpb.Operand) error {
 	// client indicates the function receives, and the result (if any)
 	// is pushed to the stack.
 	// opA = string: name of the function
-
-	// TODO: typecheck FuncMap during preprocessing
-	// TODO: a lot of this is very forgiving...
 	funcname := operands[0].GetStringValue()
-	function, found := vm.FuncMap[funcname]
-	if !found {
-		return fmt.Errorf("%q %w", funcname, ErrFunctionNotFound)
+	function, err := vm.lookupFunc(funcname)
+	if err != nil {
+		return err
 	}
-	functype := reflect.TypeOf(function)
-	if functype.Kind() != reflect.Func {
-		return fmt.Errorf("%w: function for %q not actually a function [type %T]", ErrWrongType, funcname, function)
+	if function == nil {
+		return fmt.Errorf("%q %w", funcname, ErrFunctionNotFound)
 	}
 	// Compiler puts number of args on top of stack
 	gotx, err := vm.state.pop()
 	if err != nil {
 		return fmt.Errorf("pop: %w", err)
 	}
-	gotArgc, err := ConvertToInt(gotx)
+	gotArgc, err := gotx.Int()
 	if err != nil {
 		return fmt.Errorf("convertToInt: %w", err)
 	}
 	// Check that we have enough args to call the func
-	switch wantArgc := functype.NumIn(); {
-	case functype.IsVariadic() && gotArgc < wantArgc-1:
-		// The last (variadic) arg is free to be empty. But we don't even have
-		// that many...
-		return fmt.Errorf("%w: insufficient args provided by program [got %d < want %d]", ErrFunctionArgMismatch, gotArgc, wantArgc-1)
-	case !functype.IsVariadic() && gotArgc != wantArgc:
-		// Gotta match exactly.
-		return fmt.Errorf("%w: wrong number of args provided by program [got %d, want %d]", ErrFunctionArgMismatch, gotArgc, wantArgc)
-	}
-
-	// Also check that function returns between 0 and 2 args; if there are two,
-	// the second is only allowed to be type error.
-	switch functype.NumOut() {
-	case 0, 1:
-		// ok
-	case 2:
-		if functype.Out(1) != errorType {
-			return fmt.Errorf("%w: wrong type for second return arg [got %s, want error]", ErrFunctionArgMismatch, functype.Out(1).Name())
-		}
-	default:
-		return fmt.Errorf("%w: unsupported number of return args [got %d, want in {0,1,2}]", ErrFunctionArgMismatch, functype.NumOut())
+	if err := function.checkArgc(gotArgc); err != nil {
+		return fmt.Errorf("calling %q: %w", funcname, err)
 	}
-
-	arg := gotArgc
-	params := make([]reflect.Value, arg)
-	for arg > 0 {
-		arg--
-		param, err := vm.state.pop()
-		if err != nil {
-			return fmt.Errorf("pop: %w", err)
-		}
-		var argtype reflect.Type
-		if functype.IsVariadic() && arg >= functype.NumIn()-1 {
-			// last arg is reported by reflect as a slice type
-			argtype = functype.In(functype.NumIn() - 1).Elem()
-		} else {
-			// Not variadic, or arg comes before the final variadic arg
-			argtype = functype.In(arg)
-		}
-		if param == nil {
-			// substitute nil param with a zero value, because nil Value can't
-			// be used.
-			params[arg] = reflect.Zero(argtype)
-			continue
-		}
-
-		// typecheck paramtype against argtype
-		if paramtype := reflect.TypeOf(param); !paramtype.AssignableTo(argtype) {
-			// attempt conversion to the type expected by the function
-			switch argtype {
-			// no case for interface{} because everything is assignable to interface{}
-			case stringType:
-				param = ConvertToString(param)
-			case float32Type:
-				p, err := ConvertToFloat32(param)
-				if err != nil {
-					return err
-				}
-				param = p
-			case float64Type:
-				p, err := ConvertToFloat64(param)
-				if err != nil {
-					return err
-				}
-				param = p
-			case intType:
-				p, err := ConvertToInt(param)
-				if err != nil {
-					return err
-				}
-				param = p
-			case boolType:
-				p, err := ConvertToBool(param)
-				if err != nil {
-					return err
-				}
-				param = p
-			default:
-				return fmt.Errorf("%w: value %v [type %T] not assignable or convertible to argument %d of %q [type %v]", ErrFunctionArgMismatch, param, param, arg, funcname, argtype)
-			}
+	args, err := vm.state.popN(gotArgc)
+	if err != nil {
+		return fmt.Errorf("popN(%d): %w", gotArgc, err)
+	}
+	if vm.Strict {
+		if err := checkArgs(function, args); err != nil {
+			return fmt.Errorf("calling %q: %w", funcname, err)
 		}
-		params[arg] = reflect.ValueOf(param)
 	}
 
 	// Because the func could overwrite PC, increment first
 	vm.state.pc++
 
-	result := reflect.ValueOf(function).Call(params)
-
-	// Error?
-	if last := functype.NumOut() - 1; last >= 0 && functype.Out(last) == errorType && !result[last].IsNil() {
-		return result[last].Interface().(error)
+	result, ok, err := function.call(vm, args)
+	if _, isArg := err.(*argumentError); isArg {
+		return fmt.Errorf("calling %q: %w", funcname, err)
 	}
-
-	// A return value?
-	if len(result) > 0 && functype.Out(0) != errorType {
-		vm.state.push(result[0].Interface())
+	if err != nil {
+		return err
+	}
+	if ok {
+		vm.state.push(result)
 	}
 	return nil
 }
@@ -594,33 +748,50 @@ func (vm *VirtualMachine) execPushVariable(operands []*yarnpb.Operand) error {
 	// Pushes the contents of a variable onto the stack.
 	// opA = name of variable
 	k := operands[0].GetStringValue()
-	v, ok := vm.Vars.GetValue(k)
+	if vm.Strict && !vm.declared(k) {
+		return fmt.Errorf("%w %q", ErrUndeclaredVariable, k)
+	}
+	v, ok, err := vm.getVar(k)
+	if err != nil {
+		return err
+	}
 	if ok {
 		vm.state.push(v)
 		vm.state.pc++
 		return nil
 	}
-	// Is it provided as an initial value?
-	w, ok := vm.Program.InitialValues[k]
-	if !ok {
-		// Neither a known nor initial value.
-		// Yarn Spinner pushes null.
-		vm.state.push(nil)
-		vm.state.pc++
-		return nil
-	}
-	switch x := w.Value.(type) {
-	case *yarnpb.Operand_BoolValue:
-		vm.state.push(x.BoolValue)
-	case *yarnpb.Operand_FloatValue:
-		vm.state.push(x.FloatValue)
-	case *yarnpb.Operand_StringValue:
-		vm.state.push(x.StringValue)
-	}
+	// Is it provided as an initial value? If not, Yarn Spinner pushes null
+	// (which is what literal returns for nil).
+	vm.state.push(vm.literal(vm.Program.InitialValues[k]))
 	vm.state.pc++
 	return nil
 }
 
+// literal converts an operand into a Value. In NumericFloat64 mode, numbers
+// are widened from float32 (see widenFloat32).
+func (vm *VirtualMachine) literal(op *yarnpb.Operand) Value {
+	if f, ok := op.GetValue().(*yarnpb.Operand_FloatValue); ok && vm.NumericMode == NumericFloat64 {
+		return NumberValue64(widenFloat32(f.FloatValue))
+	}
+	return valueFromOperand(op)
+}
+
+// getVar reads a variable from Vars.
+func (vm *VirtualMachine) getVar(k string) (Value, bool, error) {
+	if tv, ok := vm.Vars.(TypedVariableStorage); ok {
+		v, ok := tv.GetTypedValue(k)
+		return v, ok, vm.varsErr()
+	}
+	x, ok := vm.Vars.GetValue(k)
+	if err := vm.varsErr(); err != nil {
+		return Value{}, false, err
+	}
+	if !ok {
+		return Value{}, false, nil
+	}
+	return valueOrOpaque(x), true, nil
+}
+
 func (vm *VirtualMachine) execStoreVariable(operands []*yarnpb.Operand) error {
 	// Stores the contents of the top of the stack in the named
 	// variable.
@@ -630,7 +801,18 @@ func (vm *VirtualMachine) execStoreVariable(operands []*yarnpb.Operand) error {
 	if err != nil {
 		return fmt.Errorf("peek: %w", err)
 	}
-	vm.Vars.SetValue(k, v)
+	if vm.Strict {
+		if err := vm.checkStore(k, v); err != nil {
+			return err
+		}
+	}
+	if ro, ok := vm.Vars.(readOnlyChecker); ok && ro.IsReadOnly(k) {
+		return fmt.Errorf("%w %q", ErrReadOnlyVariable, k)
+	}
+	storeValue(vm.Vars, k, v)
+	if err := vm.varsErr(); err != nil {
+		return err
+	}
 	vm.state.pc++
 	return nil
 }
@@ -655,22 +837,111 @@ func (vm *VirtualMachine) execRunNode([]*yarnpb.Operand) error {
 	return nil
 }
 
+// declared reports whether a variable is declared. Variables used
+// internally by Yarn Spinner (such as visit counts) are always declared.
+func (vm *VirtualMachine) declared(k string) bool {
+	if strings.HasPrefix(k, "$Yarn.Internal.") {
+		return true
+	}
+	_, ok := vm.Program.InitialValues[k]
+	return ok
+}
+
+// checkStore checks that storing v in variable k is allowed in strict mode.
+func (vm *VirtualMachine) checkStore(k string, v Value) error {
+	if !vm.declared(k) {
+		return fmt.Errorf("%w %q", ErrUndeclaredVariable, k)
+	}
+	op, ok := vm.Program.InitialValues[k]
+	if !ok {
+		return nil
+	}
+	if want := valueFromOperand(op).Kind(); v.Kind() != want {
+		return fmt.Errorf("%w: variable %q is declared as %v, but the value is %v", ErrWrongType, k, want, v.Kind())
+	}
+	return nil
+}
+
+// sameKindOperators are the untyped operators (with Any parameters) whose
+// operands must be the same kind in strict mode. Yarn Spinner's type checker
+// never allows, for example, comparing a number with a string.
+var sameKindOperators = map[string]bool{
+	"EqualTo":    true,
+	"NotEqualTo": true,
+	"Add":        true,
+}
+
+// checkArgs checks that args have the types of the function's parameters, for
+// strict mode.
+func checkArgs(f *function, args []Value) error {
+	params := f.decl.Parameters
+	for i, arg := range args {
+		if arg.IsNull() {
+			return fmt.Errorf("argument %d: %w", i, ErrNullValue)
+		}
+		want := params[min(i, len(params)-1)]
+		if !want.accepts(arg.Kind()) {
+			return fmt.Errorf("argument %d: %w from %v to %v", i, ErrImplicitConversion, arg.Kind(), want)
+		}
+	}
+	if sameKindOperators[f.decl.Name] && len(args) == 2 && args[0].Kind() != args[1].Kind() {
+		return fmt.Errorf("%w between %v and %v", ErrImplicitConversion, args[0].Kind(), args[1].Kind())
+	}
+	return nil
+}
+
+// popNStrings pops n values from the stack as strings, for substituting into
+// lines and commands. In strict mode, null values are an error.
+func (vm *VirtualMachine) popNStrings(n int) ([]string, error) {
+	if vm.Strict && n > 0 && n <= len(vm.state.stack) {
+		for i, x := range vm.state.stack[len(vm.state.stack)-n:] {
+			if x.IsNull() {
+				return nil, fmt.Errorf("substitution %d: %w", i, ErrNullValue)
+			}
+		}
+	}
+	return vm.state.popNStrings(n)
+}
+
+// popSubstitutions pops n values for the substitutions of a line, returning
+// them both as strings and as Values.
+func (vm *VirtualMachine) popSubstitutions(n int) ([]string, []Value, error) {
+	var vs []Value
+	if n > 0 && n <= len(vm.state.stack) {
+		vs = slices.Clone(vm.state.stack[len(vm.state.stack)-n:])
+	}
+	ss, err := vm.popNStrings(n)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ss, vs, nil
+}
+
 type state struct {
-	node    *yarnpb.Node // current node
-	pc      int          // program counter
-	stack   []interface{}
-	options []Option
+	node     *yarnpb.Node // current node
+	pc       int          // program counter
+	stack    []Value
+	options  []Option
+	f64      bool  // numbers have float64 precision (NumericFloat64)
+	lastLine *Line // the last line, if tagged #lastline
 }
 
-// push pushes a value onto the state's stack.
-func (s *state) push(x interface{}) { s.stack = append(s.stack, x) }
+// push pushes a value onto the state's stack. In NumericFloat64 mode, numbers
+// are given float64 precision (see NumberValue64), which affects how they are
+// converted to interface{} and string.
+func (s *state) push(x Value) {
+	if s.f64 && x.kind == NumberKind {
+		x = NumberValue64(x.num)
+	}
+	s.stack = append(s.stack, x)
+}
 
 // pop removes a value from the stack and returns it.
-func (s *state) pop() (interface{}, error) {
+func (s *state) pop() (Value, error) {
 	// pop = (peek and then chuck out the top)
 	x, err := s.peek()
 	if err != nil {
-		return nil, err
+		return Value{}, err
 	}
 	s.stack = s.stack[:len(s.stack)-1]
 	return x, nil
@@ -681,11 +952,10 @@ func (s *state) popBool() (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	b, ok := x.(bool)
-	if !ok {
-		return false, fmt.Errorf("%w from stack [%T != bool]", ErrWrongType, x)
+	if x.kind != BoolKind {
+		return false, fmt.Errorf("%w from stack [%v != bool]", ErrWrongType, x.kind)
 	}
-	return b, nil
+	return x.Bool(), nil
 }
 
 func (s *state) popString() (string, error) {
@@ -693,11 +963,10 @@ func (s *state) popString() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	t, ok := x.(string)
-	if !ok {
-		return "", fmt.Errorf("%w from stack [%T != string]", ErrWrongType, x)
+	if x.kind != StringKind {
+		return "", fmt.Errorf("%w from stack [%v != string]", ErrWrongType, x.kind)
 	}
-	return t, nil
+	return x.str, nil
 }
 
 // Reading N strings from the stack is common enough that I made a dedicated
@@ -715,16 +984,32 @@ func (s *state) popNStrings(n int) ([]string, error) {
 	rem := len(s.stack) - n
 	ss := make([]string, n)
 	for i, x := range s.stack[rem:] {
-		ss[i] = ConvertToString(x)
+		ss[i] = x.String()
 	}
 	s.stack = s.stack[:rem]
 	return ss, nil
 }
 
+// popN removes the top n values from the stack and returns them, in the order
+// they were pushed. The returned slice shares memory with the stack, so it is
+// only valid until the next push.
+func (s *state) popN(n int) ([]Value, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("popping %d items", n)
+	}
+	if n > len(s.stack) {
+		return nil, fmt.Errorf("%w [%d > %d]", ErrStackUnderflow, n, len(s.stack))
+	}
+	rem := len(s.stack) - n
+	xs := s.stack[rem:]
+	s.stack = s.stack[:rem]
+	return xs, nil
+}
+
 // peek returns the top vaue from the stack only.
-func (s *state) peek() (interface{}, error) {
+func (s *state) peek() (Value, error) {
 	if len(s.stack) == 0 {
-		return nil, ErrStackUnderflow
+		return Value{}, ErrStackUnderflow
 	}
 	return s.stack[len(s.stack)-1], nil
 }
@@ -735,9 +1020,8 @@ func (s *state) peekString() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	t, ok := x.(string)
-	if !ok {
-		return "", fmt.Errorf("%w from stack [%T != string]", ErrWrongType, x)
+	if x.kind != StringKind {
+		return "", fmt.Errorf("%w from stack [%v != string]", ErrWrongType, x.kind)
 	}
-	return t, nil
+	return x.str, nil
 }
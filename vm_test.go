@@ -30,69 +30,79 @@ func TestAllTestPlans(t *testing.T) {
 	}
 
 	for _, tpn := range testplans {
-		t.Run(tpn, func(t *testing.T) {
-			testplan, err := LoadTestPlanFile(tpn)
-			if err != nil {
-				t.Fatalf("LoadTestPlanFile(%q) = error %v", tpn, err)
-			}
+		base := strings.TrimSuffix(filepath.Base(tpn), ".testplan")
+		for _, mode := range []NumericMode{NumericFloat32, NumericFloat64} {
+			t.Run(tpn+"/"+mode.String(), func(t *testing.T) {
+				runTestPlan(t, base, NewMapVariableStorage(), mode)
+			})
+		}
+	}
+}
 
-			base := strings.TrimSuffix(filepath.Base(tpn), ".testplan")
+// runTestPlan runs testdata/base.yarnc from the Start node, checking it
+// against testdata/base.testplan, with vars as the variable storage.
+func runTestPlan(t *testing.T, base string, vars VariableStorage, mode NumericMode) {
+	t.Helper()
+	tpn := "testdata/" + base + ".testplan"
+	testplan, err := LoadTestPlanFile(tpn)
+	if err != nil {
+		t.Fatalf("LoadTestPlanFile(%q) = error %v", tpn, err)
+	}
 
-			yarnc := "testdata/" + base + ".yarnc"
-			prog, st, err := LoadFiles(yarnc, "en")
-			if err != nil {
-				t.Fatalf("LoadFiles(%q, en) = error %v", yarnc, err)
-			}
+	yarnc := "testdata/" + base + ".yarnc"
+	prog, st, err := LoadFiles(yarnc, "en")
+	if err != nil {
+		t.Fatalf("LoadFiles(%q, en) = error %v", yarnc, err)
+	}
 
-			vm := &VirtualMachine{
-				Program: prog,
-				Handler: testplan,
-				Vars:    NewMapVariableStorage(),
-				FuncMap: FuncMap{
-					// Used by various
-					"assert": func(x interface{}) error {
-						t, err := ConvertToBool(x)
-						if err != nil {
-							return err
-						}
-						if !t {
-							return errors.New("assertion failed")
-						}
-						return nil
-					},
-					// Used by Functions.yarn
-					// TODO: support ints like the real Yarn Spinner
-					"add_three_operands": func(x, y, z float32) float32 {
-						return x + y + z
-					},
-					"last_value": func(x ...interface{}) (interface{}, error) {
-						if len(x) == 0 {
-							return nil, errors.New("no args")
-						}
-						return x[len(x)-1], nil
-					},
-					"dummy_number": func() float32 {
-						return 1
-					},
-					"dummy_bool": func() bool {
-						return true
-					},
-					"dummy_string": func() string {
-						return "string"
-					},
-				},
-			}
-			testplan.StringTable = st
-			if traceOutput {
-				vm.TraceLogf = t.Logf
-			}
+	vm := &VirtualMachine{
+		Program: prog,
+		Handler: testplan,
+		Vars:    vars,
+		FuncMap: FuncMap{
+			// Used by various
+			"assert": func(x interface{}) error {
+				t, err := ConvertToBool(x)
+				if err != nil {
+					return err
+				}
+				if !t {
+					return errors.New("assertion failed")
+				}
+				return nil
+			},
+			// Used by Functions.yarn
+			// TODO: support ints like the real Yarn Spinner
+			"add_three_operands": func(x, y, z float32) float32 {
+				return x + y + z
+			},
+			"last_value": func(x ...interface{}) (interface{}, error) {
+				if len(x) == 0 {
+					return nil, errors.New("no args")
+				}
+				return x[len(x)-1], nil
+			},
+			"dummy_number": func() float32 {
+				return 1
+			},
+			"dummy_bool": func() bool {
+				return true
+			},
+			"dummy_string": func() string {
+				return "string"
+			},
+		},
+		NumericMode: mode,
+	}
+	testplan.StringTable = st
+	if traceOutput {
+		vm.TraceLogf = t.Logf
+	}
 
-			if err := vm.Run("Start"); err != nil {
-				t.Errorf("vm.Run(Start) = %v", err)
-			}
-			if err := testplan.Complete(); err != nil {
-				t.Errorf("testplan incomplete: %v", err)
-			}
-		})
+	if err := vm.Run("Start"); err != nil {
+		t.Errorf("vm.Run(Start) = %v", err)
+	}
+	if err := testplan.Complete(); err != nil {
+		t.Errorf("testplan incomplete: %v", err)
 	}
 }